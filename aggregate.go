@@ -0,0 +1,235 @@
+package dbo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AggFunc aggregate function
+type AggFunc string
+
+const (
+	AggSum           AggFunc = "sum"
+	AggMax           AggFunc = "max"
+	AggMin           AggFunc = "min"
+	AggAvg           AggFunc = "avg"
+	AggCount         AggFunc = "count"
+	AggCountDistinct AggFunc = "count_distinct"
+)
+
+// Agg aggregate of column
+type Agg struct {
+	Func AggFunc
+	// Column field name or column name of model, empty for count(*) of AggCount
+	Column string
+	// As column name of result, default to func_column, e.g. sum_amount, or count for count(*)
+	As string
+}
+
+// AggSpec aggregates and group by of Aggregate
+type AggSpec struct {
+	Aggs []Agg
+	// GroupBy field names or column names of model, group by columns are selected into result as well
+	GroupBy []string
+}
+
+var aggAliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Aggregate aggregate records matching condition, model is the model to aggregate and out is a pointer to result,
+// a struct for aggregates without group by or a slice of struct with group by, result columns are named by Agg.As.
+// Order by and pager of condition apply to groups only, groups can be sorted by Agg.As, e.g. Sort{{Column: "count", Desc: true}}.
+// Having of GroupConditions filters groups, e.g. "count(*) > ?", group by of condition is rejected in favor of AggSpec.GroupBy
+func (s BaseDA) Aggregate(ctx context.Context, condition Conditions, model interface{}, spec AggSpec, out interface{}) error {
+	db, err := s.getReadDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.AggregateTx(ctx, db, condition, model, spec, out)
+}
+
+// AggregateTx aggregate records matching condition with db context, see Aggregate
+func (s BaseDA) AggregateTx(ctx context.Context, db *DBContext, condition Conditions, model interface{}, spec AggSpec, out interface{}) error {
+	db.ResetCondition().applyScope(ctx)
+
+	query, err := db.aggregateClauses(model, spec)
+	if err == nil {
+		err = db.applyAggregateHaving(condition, query)
+	}
+	if err != nil {
+		log.Warn(ctx, "aggregate failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(model)),
+			log.Any("condition", condition),
+			log.Any("spec", spec))
+		return err
+	}
+
+	db.applyJoins(condition)
+	db.applyConditions(condition)
+	db.DB = db.Model(model).Select(query.selectSQL, query.vars...)
+
+	var orderBy string
+	if len(query.groupBy.Columns) > 0 {
+		db.DB = db.Clauses(query.groupBy)
+		orderBy, _, err = db.applyOrderAndPager(condition, model, query.aliases...)
+		if err != nil {
+			log.Warn(ctx, "aggregate failed",
+				log.Err(err),
+				log.String("tableName", db.GetTableName(model)),
+				log.Any("condition", condition),
+				log.Any("spec", spec),
+				log.String("orderBy", orderBy))
+			return err
+		}
+	}
+
+	start := time.Now()
+	err = db.Scan(out).Error
+	if err != nil {
+		log.Warn(ctx, "aggregate failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(model)),
+			log.Any("condition", condition),
+			log.Any("spec", spec),
+			log.String("orderBy", orderBy),
+			log.Duration("duration", time.Since(start)))
+		return err
+	}
+
+	log.Debug(ctx, "aggregate successfully",
+		log.String("tableName", db.GetTableName(model)),
+		log.Any("condition", condition),
+		log.Any("spec", spec),
+		log.String("orderBy", orderBy),
+		log.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// aggregateQuery select expression, group by and result column aliases of AggSpec
+type aggregateQuery struct {
+	selectSQL string
+	vars      []interface{}
+	groupBy   clause.GroupBy
+	aliases   []string
+}
+
+// aggregateClauses select expression and group by of spec, columns are validated against fields of model
+func (s *DBContext) aggregateClauses(model interface{}, spec AggSpec) (*aggregateQuery, error) {
+	if len(spec.Aggs) == 0 {
+		return nil, fmt.Errorf("%w: no aggregate", ErrInvalidAggregate)
+	}
+
+	stmt := &gorm.Statement{DB: s.DB}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	column := func(name string) (clause.Column, error) {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return clause.Column{}, fmt.Errorf("%w: unknown column %s", ErrInvalidAggregate, name)
+		}
+
+		return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, nil
+	}
+
+	query := &aggregateQuery{aliases: make([]string, 0, len(spec.Aggs))}
+	selects := make([]string, 0, len(spec.GroupBy)+len(spec.Aggs))
+	vars := make([]interface{}, 0, len(spec.GroupBy)+len(spec.Aggs)*2)
+	for _, name := range spec.GroupBy {
+		groupColumn, err := column(name)
+		if err != nil {
+			return nil, err
+		}
+
+		query.groupBy.Columns = append(query.groupBy.Columns, groupColumn)
+		selects = append(selects, "?")
+		vars = append(vars, groupColumn)
+	}
+
+	for _, agg := range spec.Aggs {
+		if agg.Func == AggCount && agg.Column == "" {
+			alias, err := aggAlias(agg, string(AggCount))
+			if err != nil {
+				return nil, err
+			}
+
+			selects = append(selects, "count(*) as ?")
+			vars = append(vars, clause.Column{Name: alias})
+			query.aliases = append(query.aliases, alias)
+			continue
+		}
+
+		aggColumn, err := column(agg.Column)
+		if err != nil {
+			return nil, err
+		}
+
+		alias, err := aggAlias(agg, string(agg.Func)+"_"+aggColumn.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch agg.Func {
+		case AggSum, AggMax, AggMin, AggAvg, AggCount:
+			selects = append(selects, string(agg.Func)+"(?) as ?")
+		case AggCountDistinct:
+			selects = append(selects, "count(distinct ?) as ?")
+		default:
+			return nil, fmt.Errorf("%w: unsupported function %s", ErrInvalidAggregate, agg.Func)
+		}
+		vars = append(vars, aggColumn, clause.Column{Name: alias})
+		query.aliases = append(query.aliases, alias)
+	}
+
+	query.selectSQL, query.vars = strings.Join(selects, ", "), vars
+	return query, nil
+}
+
+// applyAggregateHaving apply having of condition if condition implements GroupConditions,
+// reject group by of condition and having without group by of spec
+func (s *DBContext) applyAggregateHaving(condition Conditions, query *aggregateQuery) error {
+	groupConditions, ok := condition.(GroupConditions)
+	if !ok {
+		return nil
+	}
+
+	if groupConditions.GetGroupBy() != "" {
+		return fmt.Errorf("%w: group by of condition, use AggSpec.GroupBy instead", ErrInvalidAggregate)
+	}
+
+	having, parameters := groupConditions.GetHaving()
+	if having == "" {
+		return nil
+	}
+
+	if len(query.groupBy.Columns) == 0 {
+		return fmt.Errorf("%w: having without AggSpec.GroupBy", ErrInvalidAggregate)
+	}
+
+	s.DB = s.DB.Having(having, parameters...)
+	return nil
+}
+
+// aggAlias result column name of agg, validated as identifier
+func aggAlias(agg Agg, defaultAlias string) (string, error) {
+	alias := agg.As
+	if alias == "" {
+		alias = defaultAlias
+	}
+
+	if !aggAliasPattern.MatchString(alias) {
+		return "", fmt.Errorf("%w: invalid alias %s", ErrInvalidAggregate, alias)
+	}
+
+	return alias, nil
+}
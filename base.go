@@ -3,18 +3,36 @@ package dbo
 import (
 	"context"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/Klasmart-Engineering/common-log/log"
-	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 )
 
-type BaseDA struct{}
+// BaseDA base data access, operate the default dbo instance unless DBName is set
+type BaseDA struct {
+	// DBName name of registered dbo instance, empty for the default one
+	DBName string
+}
+
+func (s BaseDA) dbName() string {
+	if s.DBName == "" {
+		return DefaultName
+	}
+
+	return s.DBName
+}
+
+func (s BaseDA) getDB(ctx context.Context) (*DBContext, error) {
+	return GetDBNamed(ctx, s.dbName())
+}
+
+func (s BaseDA) getReadDB(ctx context.Context) (*DBContext, error) {
+	return GetReadDBNamed(ctx, s.dbName())
+}
 
 func (s BaseDA) Insert(ctx context.Context, value interface{}) (interface{}, error) {
-	db, err := GetDB(ctx)
+	db, err := s.getDB(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -24,16 +42,17 @@ func (s BaseDA) Insert(ctx context.Context, value interface{}) (interface{}, err
 
 func (s BaseDA) InsertTx(ctx context.Context, db *DBContext, value interface{}) (interface{}, error) {
 	start := time.Now()
+	db.initVersions(value)
 	err := db.ResetCondition().Create(value).Error
 	if err != nil {
-		me, ok := err.(*mysql.MySQLError)
-		if ok && me.Number == 1062 {
-			log.Warn(ctx, "insert duplicate record",
-				log.Err(me),
+		if constraintErr := db.constraintError(err); constraintErr != nil {
+			log.Warn(ctx, "insert violates constraint",
+				log.Err(err),
+				log.String("violation", constraintErr.Error()),
 				log.String("tableName", db.GetTableName(value)),
 				log.Any("value", value),
 				log.Duration("duration", time.Since(start)))
-			return 0, ErrDuplicateRecord
+			return 0, constraintErr
 		}
 
 		log.Warn(ctx, "insert failed",
@@ -54,7 +73,7 @@ func (s BaseDA) InsertTx(ctx context.Context, db *DBContext, value interface{})
 
 // InsertInBatches Insert records in batch. visit https://gorm.io/docs/create.html for detail
 func (s BaseDA) InsertInBatches(ctx context.Context, value interface{}, batchSize int) (interface{}, error) {
-	db, err := GetDB(ctx)
+	db, err := s.getDB(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -65,16 +84,17 @@ func (s BaseDA) InsertInBatches(ctx context.Context, value interface{}, batchSiz
 // InsertInBatchesTx Insert records in batch with context. visit https://gorm.io/docs/create.html for detail
 func (s BaseDA) InsertInBatchesTx(ctx context.Context, db *DBContext, value interface{}, batchSize int) (interface{}, error) {
 	start := time.Now()
+	db.initVersions(value)
 	err := db.ResetCondition().CreateInBatches(value, batchSize).Error
 	if err != nil {
-		me, ok := err.(*mysql.MySQLError)
-		if ok && me.Number == 1062 {
-			log.Warn(ctx, "insertBatches duplicate record",
-				log.Err(me),
+		if constraintErr := db.constraintError(err); constraintErr != nil {
+			log.Warn(ctx, "insertBatches violates constraint",
+				log.Err(err),
+				log.String("violation", constraintErr.Error()),
 				log.String("tableName", db.GetTableName(value)),
 				log.Any("value", value),
 				log.Duration("duration", time.Since(start)))
-			return 0, ErrDuplicateRecord
+			return 0, constraintErr
 		}
 
 		log.Warn(ctx, "insertBatches failed",
@@ -93,8 +113,9 @@ func (s BaseDA) InsertInBatchesTx(ctx context.Context, db *DBContext, value inte
 	return value, nil
 }
 
+// Update update record, see UpdateTx
 func (s BaseDA) Update(ctx context.Context, value interface{}) (int64, error) {
-	db, err := GetDB(ctx)
+	db, err := s.getDB(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -102,18 +123,31 @@ func (s BaseDA) Update(ctx context.Context, value interface{}) (int64, error) {
 	return s.UpdateTx(ctx, db, value)
 }
 
+// UpdateTx update record with db context.
+// If model has a version field (tagged with `dbo:"version"` or named by Versioner), the record is updated
+// only if its version is unchanged since loaded and the version is increased, otherwise return ErrStaleRecord
 func (s BaseDA) UpdateTx(ctx context.Context, db *DBContext, value interface{}) (int64, error) {
 	start := time.Now()
-	newDB := db.ResetCondition().Save(value)
+	db.ResetCondition()
+
+	var newDB *gorm.DB
+	version := db.recordVersion(value)
+	if version != nil {
+		newDB = version.update(db, value)
+	} else {
+		db.initVersions(value)
+		newDB = db.Save(value)
+	}
 	if newDB.Error != nil {
-		me, ok := newDB.Error.(*mysql.MySQLError)
-		if ok && me.Number == 1062 {
-			log.Warn(ctx, "update duplicate record",
-				log.Err(me),
+		version.rollback()
+		if constraintErr := db.constraintError(newDB.Error); constraintErr != nil {
+			log.Warn(ctx, "update violates constraint",
+				log.Err(newDB.Error),
+				log.String("violation", constraintErr.Error()),
 				log.String("tableName", db.GetTableName(value)),
 				log.Any("value", value),
 				log.Duration("duration", time.Since(start)))
-			return 0, ErrDuplicateRecord
+			return 0, constraintErr
 		}
 
 		log.Warn(ctx, "update failed",
@@ -124,6 +158,15 @@ func (s BaseDA) UpdateTx(ctx context.Context, db *DBContext, value interface{})
 		return 0, newDB.Error
 	}
 
+	if version != nil && newDB.RowsAffected == 0 {
+		version.rollback()
+		log.Warn(ctx, "update stale record",
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("value", value),
+			log.Duration("duration", time.Since(start)))
+		return 0, ErrStaleRecord
+	}
+
 	log.Debug(ctx, "update successfully",
 		log.String("tableName", db.GetTableName(value)),
 		log.Any("value", value),
@@ -132,8 +175,126 @@ func (s BaseDA) UpdateTx(ctx context.Context, db *DBContext, value interface{})
 	return newDB.RowsAffected, nil
 }
 
+// UpdateColumns update columns of record by id, value is the model to update,
+// only columns in changes are written, other columns remain untouched
+func (s BaseDA) UpdateColumns(ctx context.Context, value interface{}, id interface{}, changes map[string]interface{}) (int64, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.UpdateColumnsTx(ctx, db, value, id, changes)
+}
+
+// UpdateColumnsTx update columns of record by id with db context, value is the model to update,
+// only columns in changes and the version field if any are written, other columns remain untouched
+func (s BaseDA) UpdateColumnsTx(ctx context.Context, db *DBContext, value interface{}, id interface{}, changes map[string]interface{}) (int64, error) {
+	db.ResetCondition().applyScope(ctx)
+
+	err := db.applyPrimaryKey(value, id)
+	if err != nil {
+		log.Warn(ctx, "update columns failed",
+			log.Err(err),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("changes", changes))
+		return 0, err
+	}
+
+	start := time.Now()
+	newDB := db.Model(value).Updates(db.versionChanges(value, changes))
+	if newDB.Error != nil {
+		if constraintErr := db.constraintError(newDB.Error); constraintErr != nil {
+			log.Warn(ctx, "update columns violates constraint",
+				log.Err(newDB.Error),
+				log.String("violation", constraintErr.Error()),
+				log.Any("id", id),
+				log.String("tableName", db.GetTableName(value)),
+				log.Any("changes", changes),
+				log.Duration("duration", time.Since(start)))
+			return 0, constraintErr
+		}
+
+		log.Warn(ctx, "update columns failed",
+			log.Err(newDB.Error),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("changes", changes),
+			log.Duration("duration", time.Since(start)))
+		return 0, newDB.Error
+	}
+
+	log.Debug(ctx, "update columns successfully",
+		log.Any("id", id),
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("changes", changes),
+		log.Any("rowsAffected", newDB.RowsAffected),
+		log.Duration("duration", time.Since(start)))
+
+	return newDB.RowsAffected, nil
+}
+
+// UpdateWhere update columns of records matching condition, value is the model to update.
+// return ErrMissingConditions if condition is empty, to avoid updating the whole table by accident, see AllRecords
+func (s BaseDA) UpdateWhere(ctx context.Context, condition Conditions, value interface{}, changes map[string]interface{}) (int64, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.UpdateWhereTx(ctx, db, condition, value, changes)
+}
+
+// UpdateWhereTx update columns of records matching condition with db context, value is the model to update.
+// return ErrMissingConditions if condition is empty, to avoid updating the whole table by accident, see AllRecords
+func (s BaseDA) UpdateWhereTx(ctx context.Context, db *DBContext, condition Conditions, value interface{}, changes map[string]interface{}) (int64, error) {
+	db.ResetCondition().applyScope(ctx)
+
+	err := db.applyRequiredConditions(condition)
+	if err != nil {
+		log.Warn(ctx, "update without conditions",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("changes", changes))
+		return 0, err
+	}
+
+	start := time.Now()
+	newDB := db.Model(value).Updates(db.versionChanges(value, changes))
+	if newDB.Error != nil {
+		if constraintErr := db.constraintError(newDB.Error); constraintErr != nil {
+			log.Warn(ctx, "update where violates constraint",
+				log.Err(newDB.Error),
+				log.String("violation", constraintErr.Error()),
+				log.String("tableName", db.GetTableName(value)),
+				log.Any("condition", condition),
+				log.Any("changes", changes),
+				log.Duration("duration", time.Since(start)))
+			return 0, constraintErr
+		}
+
+		log.Warn(ctx, "update where failed",
+			log.Err(newDB.Error),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("changes", changes),
+			log.Duration("duration", time.Since(start)))
+		return 0, newDB.Error
+	}
+
+	log.Debug(ctx, "update where successfully",
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("condition", condition),
+		log.Any("changes", changes),
+		log.Any("rowsAffected", newDB.RowsAffected),
+		log.Duration("duration", time.Since(start)))
+
+	return newDB.RowsAffected, nil
+}
+
 func (s BaseDA) Save(ctx context.Context, value interface{}) error {
-	db, err := GetDB(ctx)
+	db, err := s.getDB(ctx)
 	if err != nil {
 		return err
 	}
@@ -162,7 +323,7 @@ func (s BaseDA) SaveTx(ctx context.Context, db *DBContext, value interface{}) er
 }
 
 func (s BaseDA) Get(ctx context.Context, id interface{}, value interface{}) error {
-	db, err := GetDB(ctx)
+	db, err := s.getReadDB(ctx)
 	if err != nil {
 		return err
 	}
@@ -170,9 +331,38 @@ func (s BaseDA) Get(ctx context.Context, id interface{}, value interface{}) erro
 	return s.GetTx(ctx, db, id, value)
 }
 
+// GetTx get record by id with db context, primary key(s) are discovered from model.
+// id is the key value for single primary key, a map keyed by field or column name,
+// or a struct with fields named as primary key fields for composite primary keys
 func (s BaseDA) GetTx(ctx context.Context, db *DBContext, id interface{}, value interface{}) error {
+	return s.GetWithLockTx(ctx, db, id, value, Lock{})
+}
+
+// GetWithLockTx get record by id and lock it, db must be in transaction, see GetTrans
+func (s BaseDA) GetWithLockTx(ctx context.Context, db *DBContext, id interface{}, value interface{}, lock Lock) error {
+	db.ResetCondition().applyScope(ctx)
+
+	err := db.applyLock(lock)
+	if err != nil {
+		log.Warn(ctx, "get by id with lock failed",
+			log.Err(err),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("lock", lock))
+		return err
+	}
+
+	err = db.applyPrimaryKey(value, id)
+	if err != nil {
+		log.Warn(ctx, "get by id failed",
+			log.Err(err),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)))
+		return err
+	}
+
 	start := time.Now()
-	err := db.ResetCondition().Where("id=?", id).First(value).Error
+	err = db.First(value).Error
 	if err == nil {
 		log.Debug(ctx, "get by id successfully",
 			log.Any("id", id),
@@ -197,7 +387,7 @@ func (s BaseDA) GetTx(ctx context.Context, db *DBContext, id interface{}, value
 }
 
 func (s BaseDA) Query(ctx context.Context, condition Conditions, values interface{}) error {
-	db, err := GetDB(ctx)
+	db, err := s.getReadDB(ctx)
 	if err != nil {
 		return err
 	}
@@ -205,51 +395,78 @@ func (s BaseDA) Query(ctx context.Context, condition Conditions, values interfac
 	return s.QueryTx(ctx, db, condition, values)
 }
 
+// QueryTx query records by condition with db context,
+// rows are locked if condition implements Locker and db must be in transaction then.
+// Records are paged by cursor instead of offset if condition implements CursorConditions, see PageByCursor
 func (s BaseDA) QueryTx(ctx context.Context, db *DBContext, condition Conditions, values interface{}) error {
-	db.ResetCondition()
-
-	wheres, parameters := condition.GetConditions()
-	if len(wheres) > 0 {
-		db.DB = db.Where(strings.Join(wheres, " and "), parameters...)
-	}
+	_, err := s.query(ctx, db, condition, values)
+	return err
+}
 
-	orderBy := condition.GetOrderBy()
-	if orderBy != "" {
-		db.DB = db.Order(orderBy)
-	}
+// query query records by condition with db context, return cursor page if condition implements CursorConditions
+func (s BaseDA) query(ctx context.Context, db *DBContext, condition Conditions, values interface{}) (*CursorPage, error) {
+	db.ResetCondition().applyScope(ctx)
 
-	pager := condition.GetPager()
-	if pager != nil && pager.Enable() {
-		// pagination
-		offset, limit := pager.Offset()
-		db.DB = db.Offset(offset).Limit(limit)
+	lock := conditionLock(condition)
+	if err := db.applyLock(lock); err != nil {
+		log.Warn(ctx, "query values with lock failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(values)),
+			log.Any("condition", condition),
+			log.Any("lock", lock))
+		return nil, err
 	}
 
+	db.applyJoins(condition)
+	db.applyConditions(condition)
+	db.applyGroup(condition)
+	db.applySelect(condition)
+	db.applyPreloads(condition)
+
+	var (
+		orderBy    string
+		pager      *Pager
+		cursorPage *CursorPage
+		err        error
+	)
 	start := time.Now()
-	err := db.Find(values).Error
+	cursorPager := conditionCursorPager(condition)
+	if cursorPager != nil {
+		err = checkCursorConditions(condition)
+		if err == nil {
+			cursorPage, err = db.findByCursor(cursorPager, values)
+		}
+	} else {
+		orderBy, pager, err = db.applyOrderAndPager(condition, values)
+		if err == nil {
+			err = db.Find(values).Error
+		}
+	}
 	if err != nil {
 		log.Warn(ctx, "query values failed",
 			log.Err(err),
 			log.String("tableName", db.GetTableName(values)),
 			log.Any("condition", condition),
 			log.Any("pager", pager),
+			log.Any("cursorPager", cursorPager),
 			log.String("orderBy", orderBy),
 			log.Duration("duration", time.Since(start)))
-		return err
+		return nil, err
 	}
 
 	log.Debug(ctx, "query values successfully",
 		log.String("tableName", db.GetTableName(values)),
 		log.Any("condition", condition),
 		log.Any("pager", pager),
+		log.Any("cursorPager", cursorPager),
 		log.String("orderBy", orderBy),
 		log.Duration("duration", time.Since(start)))
 
-	return nil
+	return cursorPage, nil
 }
 
 func (s BaseDA) Count(ctx context.Context, condition Conditions, values interface{}) (int, error) {
-	db, err := GetDB(ctx)
+	db, err := s.getReadDB(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -257,18 +474,42 @@ func (s BaseDA) Count(ctx context.Context, condition Conditions, values interfac
 	return s.CountTx(ctx, db, condition, values)
 }
 
+// CountTx count records matching condition with db context,
+// records are counted over the query as subquery if condition has joins or group by, so that count matches query result
 func (s BaseDA) CountTx(ctx context.Context, db *DBContext, condition Conditions, value interface{}) (int, error) {
-	db.ResetCondition()
+	db.ResetCondition().applyScope(ctx)
 
-	wheres, parameters := condition.GetConditions()
-	if len(wheres) > 0 {
-		db.DB = db.Where(strings.Join(wheres, " and "), parameters...)
+	// lock rows counted in subquery, aggregate functions can't be locked
+	lock := conditionLock(condition)
+	if err := db.applyLock(lock); err != nil {
+		log.Warn(ctx, "count with lock failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("lock", lock))
+		return 0, err
 	}
 
+	joined := db.applyJoins(condition)
+	db.applyConditions(condition)
+	groupBy := db.applyGroup(condition)
+
 	start := time.Now()
 	var total int64
 	tableName := db.GetTableName(value)
-	err := db.Table(tableName).Count(&total).Error
+	var err error
+	// count by model to apply soft delete scope of model
+	if joined || groupBy != "" || lock.Enable() {
+		db.applySelect(condition)
+		if len(db.Statement.Selects) == 0 && groupBy != "" {
+			db.DB = db.Select(groupBy)
+		}
+
+		subQuery := db.Model(value)
+		err = db.Session(&gorm.Session{NewDB: true}).Table("(?) as dbo_count", subQuery).Count(&total).Error
+	} else {
+		err = db.Model(value).Count(&total).Error
+	}
 	if err != nil {
 		log.Warn(ctx, "count failed",
 			log.Err(err),
@@ -287,7 +528,7 @@ func (s BaseDA) CountTx(ctx context.Context, db *DBContext, condition Conditions
 }
 
 func (s BaseDA) Page(ctx context.Context, condition Conditions, values interface{}) (int, error) {
-	db, err := GetDB(ctx)
+	db, err := s.getReadDB(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -310,7 +551,7 @@ func (s BaseDA) PageTx(ctx context.Context, db *DBContext, condition Conditions,
 }
 
 func (s BaseDA) QueryRawSQL(ctx context.Context, values interface{}, sql string, parameters ...interface{}) error {
-	db, err := GetDB(ctx)
+	db, err := s.getReadDB(ctx)
 	if err != nil {
 		return err
 	}
@@ -337,3 +578,90 @@ func (s BaseDA) QueryRawSQLTx(ctx context.Context, db *DBContext, values interfa
 
 	return nil
 }
+
+// Delete delete record by id, soft delete if model has DeletedAt field
+func (s BaseDA) Delete(ctx context.Context, id interface{}, value interface{}) (int64, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.DeleteTx(ctx, db, id, value)
+}
+
+// DeleteTx delete record by id with db context, soft delete if model has DeletedAt field
+func (s BaseDA) DeleteTx(ctx context.Context, db *DBContext, id interface{}, value interface{}) (int64, error) {
+	db.ResetCondition().applyScope(ctx)
+
+	err := db.applyPrimaryKey(value, id)
+	if err != nil {
+		log.Warn(ctx, "delete by id failed",
+			log.Err(err),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)))
+		return 0, err
+	}
+
+	start := time.Now()
+	newDB := db.Delete(value)
+	if newDB.Error != nil {
+		log.Warn(ctx, "delete by id failed",
+			log.Err(newDB.Error),
+			log.Any("id", id),
+			log.String("tableName", db.GetTableName(value)),
+			log.Duration("duration", time.Since(start)))
+		return 0, newDB.Error
+	}
+
+	log.Debug(ctx, "delete by id successfully",
+		log.Any("id", id),
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("rowsAffected", newDB.RowsAffected),
+		log.Duration("duration", time.Since(start)))
+
+	return newDB.RowsAffected, nil
+}
+
+// DeleteByConditions delete records matching condition, soft delete if model has DeletedAt field
+func (s BaseDA) DeleteByConditions(ctx context.Context, condition Conditions, value interface{}) (int64, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.DeleteByConditionsTx(ctx, db, condition, value)
+}
+
+// DeleteByConditionsTx delete records matching condition with db context, soft delete if model has DeletedAt field.
+// return ErrMissingConditions if condition is empty, to avoid deleting the whole table by accident, see AllRecords
+func (s BaseDA) DeleteByConditionsTx(ctx context.Context, db *DBContext, condition Conditions, value interface{}) (int64, error) {
+	db.ResetCondition().applyScope(ctx)
+
+	err := db.applyRequiredConditions(condition)
+	if err != nil {
+		log.Warn(ctx, "delete without conditions",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition))
+		return 0, err
+	}
+
+	start := time.Now()
+	newDB := db.Delete(value)
+	if newDB.Error != nil {
+		log.Warn(ctx, "delete by conditions failed",
+			log.Err(newDB.Error),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Duration("duration", time.Since(start)))
+		return 0, newDB.Error
+	}
+
+	log.Debug(ctx, "delete by conditions successfully",
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("condition", condition),
+		log.Any("rowsAffected", newDB.RowsAffected),
+		log.Duration("duration", time.Since(start)))
+
+	return newDB.RowsAffected, nil
+}
@@ -2,11 +2,21 @@ package dbo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/Klasmart-Engineering/common-log/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Class struct {
@@ -19,6 +29,52 @@ type School struct {
 	Name string `gorm:"column:school_name;type:varchar(64);" json:"school_name"`
 }
 
+type Student struct {
+	ID        uint      `gorm:"column:id;primaryKey;autoIncrement:true;autoIncrementIncrement:1"`
+	Name      string    `gorm:"column:name;type:varchar(64);" json:"name"`
+	DeletedAt DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at"`
+}
+
+type Teacher struct {
+	ID      uint   `gorm:"column:id;primaryKey;autoIncrement:true;autoIncrementIncrement:1"`
+	Name    string `gorm:"column:name;type:varchar(64);" json:"name"`
+	Version int64  `gorm:"column:version" dbo:"version" json:"version"`
+}
+
+type Enrollment struct {
+	StudentID uint   `gorm:"column:student_id;primaryKey;autoIncrement:false"`
+	ClassID   uint   `gorm:"column:class_id;primaryKey;autoIncrement:false"`
+	Grade     string `gorm:"column:grade;type:varchar(8);" json:"grade"`
+}
+
+type Subject struct {
+	Code string `gorm:"column:code;primaryKey;type:varchar(32)"`
+	Name string `gorm:"column:name;type:varchar(64);" json:"name"`
+}
+
+// SubjectCode typed key printed differently from its value
+type SubjectCode string
+
+func (c SubjectCode) String() string {
+	return "subject:" + string(c)
+}
+
+func (Subject) TableName() string {
+	return "subject"
+}
+
+func (Enrollment) TableName() string {
+	return "enrollment"
+}
+
+func (Teacher) TableName() string {
+	return "teacher"
+}
+
+func (Student) TableName() string {
+	return "student"
+}
+
 func (School) TableName() string {
 	return "School"
 }
@@ -83,25 +139,74 @@ func (c *ClassConditions) GetOrderBy() string {
 	return ""
 }
 
-func initDB() {
+// initDB use a temporary SQLite database by default, set DBO_TEST_MYSQL_DSN to run against MySQL
+func initDB(dir string) {
 	dboHandler, err := NewWithConfig(func(c *Config) {
 		c.ShowLog = true
 		c.ShowSQL = true
 		c.MaxIdleConns = 10
 		c.MaxOpenConns = 10
-		c.ConnectionString = "root:123456@tcp(127.0.0.1:3306)/ai_facerecognition?charset=utf8mb4&parseTime=True&loc=Local"
+		c.DBType = SQLite
+		c.ConnectionString = filepath.Join(dir, "dbo_test.db")
+		if dsn := os.Getenv("DBO_TEST_MYSQL_DSN"); dsn != "" {
+			c.DBType = MySQL
+			c.ConnectionString = dsn
+		}
 		c.LogLevel = Info
 	})
 	if err != nil {
 		log.Error(context.TODO(), "create dbo failed", log.Err(err))
 		panic(err)
 	}
+
+	err = dboHandler.db.AutoMigrate(&Class{}, &School{}, &Student{}, &Teacher{}, &Enrollment{}, &Subject{})
+	if err != nil {
+		log.Error(context.TODO(), "migrate test tables failed", log.Err(err))
+		panic(err)
+	}
 	ReplaceGlobal(dboHandler)
 }
 
 func TestMain(m *testing.M) {
-	initDB()
-	os.Exit(m.Run())
+	dir, err := os.MkdirTemp("", "dbo")
+	if err != nil {
+		panic(err)
+	}
+
+	initDB(dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// insertFixtures insert values for test t and delete them permanently when t finishes,
+// so fixtures of a test never collide with other tests or previous runs against a persistent database
+func insertFixtures[T any](t *testing.T, values []T) {
+	t.Helper()
+	ctx := context.Background()
+	err := BaseRepo[T]{}.InsertInBatches(ctx, values, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		for _, value := range values {
+			_, err := BaseRepo[T]{}.Delete(Unscoped(ctx), value)
+			if err != nil {
+				t.Errorf("delete fixtures failed: %v", err)
+			}
+		}
+	})
+}
+
+// cleanupFixtures delete records matching condition permanently when t finishes, for records created by the test itself
+func cleanupFixtures[T any](t *testing.T, condition Conditions) {
+	t.Cleanup(func() {
+		_, err := BaseRepo[T]{}.DeleteByConditions(Unscoped(context.Background()), condition)
+		if err != nil {
+			t.Errorf("delete fixtures failed: %v", err)
+		}
+	})
 }
 
 func TestFind(t *testing.T) {
@@ -138,6 +243,979 @@ func TestInsertBatches(t *testing.T) {
 	fmt.Println(err, classes)
 }
 
+func TestInsertDuplicate(t *testing.T) {
+	ctx := context.Background()
+	class := Class{Name: "class-duplicate"}
+	_, err := BaseDA{}.Insert(ctx, &class)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate := Class{ID: class.ID, Name: "class-duplicate"}
+	_, err = BaseDA{}.Insert(ctx, &duplicate)
+	if !errors.Is(err, ErrDuplicateRecord) {
+		t.Errorf("expect ErrDuplicateRecord, got %v", err)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		dialect Dialect
+		err     error
+		expect  error
+	}{
+		{MySQLDialect{}, &mysql.MySQLError{Number: 1062}, ErrDuplicateRecord},
+		{MySQLDialect{}, &mysql.MySQLError{Number: 1452}, ErrForeignKeyViolation},
+		{MySQLDialect{}, &mysql.MySQLError{Number: 1213}, ErrDeadlock},
+		{MySQLDialect{}, &mysql.MySQLError{Number: 1205}, ErrLockWaitTimeout},
+		{PostgresDialect{}, &pgconn.PgError{Code: "40P01"}, ErrDeadlock},
+		{SQLiteDialect{}, sqlite3.Error{Code: sqlite3.ErrBusy}, ErrLockWaitTimeout},
+		{PostgresDialect{}, &pgconn.PgError{Code: "23505"}, ErrDuplicateRecord},
+		{PostgresDialect{}, &pgconn.PgError{Code: "23502"}, ErrNotNullViolation},
+		{PostgresDialect{}, &pgconn.PgError{Code: "23503"}, ErrForeignKeyViolation},
+		{PostgresDialect{}, &pgconn.PgError{Code: "23514"}, ErrCheckViolation},
+		{PostgresDialect{}, &pgconn.PgError{Code: "42P01"}, nil},
+		{PostgresDialect{}, &mysql.MySQLError{Number: 1062}, nil},
+		{SQLiteDialect{}, errors.New("unknown"), nil},
+	}
+	for _, c := range cases {
+		if err := c.dialect.ClassifyError(c.err); err != c.expect {
+			t.Errorf("classify %v with %T: expect %v, got %v", c.err, c.dialect, c.expect, err)
+		}
+	}
+}
+
+var (
+	_ QueryCanceler = MySQLDialect{}
+	_ QueryCanceler = PostgresDialect{}
+)
+
+func TestUnsupportedDBType(t *testing.T) {
+	_, err := New(WithDBType("unknown"))
+	if !errors.Is(err, ErrUnsupportedDBType) {
+		t.Errorf("expect ErrUnsupportedDBType, got %v", err)
+	}
+}
+
+func TestReplicaRouting(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	replicaDBO, err := New(WithDBType(SQLite),
+		WithConnectionString(filepath.Join(dir, "primary.db")),
+		WithReplicas(filepath.Join(dir, "replica1.db"), filepath.Join(dir, "replica2.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = replicaDBO.db.AutoMigrate(&Class{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, replica := range replicaDBO.replicas.dbs {
+		err = replica.AutoMigrate(&Class{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = BaseDA{}.InsertTx(ctx, replicaDBO.GetDB(ctx), &Class{Name: "class-primary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(replicaDBO.replicas.dbs); i++ {
+		count, err := BaseDA{}.CountTx(ctx, replicaDBO.GetReadDB(ctx), &ClassConditions{}, &Class{})
+		if err != nil || count != 0 {
+			t.Errorf("expect empty replica, got %d, %v", count, err)
+		}
+	}
+
+	count, err := BaseDA{}.CountTx(ctx, replicaDBO.GetReadDB(ForcePrimary(ctx)), &ClassConditions{}, &Class{})
+	if err != nil || count != 1 {
+		t.Errorf("expect read from primary, got %d, %v", count, err)
+	}
+}
+
+func TestNamedDBO(t *testing.T) {
+	ctx := context.Background()
+	reportDBO, err := New(WithDBType(SQLite), WithConnectionString(filepath.Join(t.TempDir(), "report.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reportDBO.db.AutoMigrate(&School{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register("report", reportDBO)
+
+	reportDA := BaseDA{DBName: "report"}
+	err = GetTransNamed(ctx, "report", func(ctx context.Context, tx *DBContext) error {
+		_, err := reportDA.InsertTx(ctx, tx, &School{Name: "school-report"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schools []School
+	err = reportDA.Query(ctx, &SchoolConditions{Name: "school-report"}, &schools)
+	if err != nil || len(schools) != 1 {
+		t.Errorf("expect school in report database, got %v, %v", schools, err)
+	}
+
+	schools = nil
+	err = BaseDA{}.Query(ctx, &SchoolConditions{Name: "school-report"}, &schools)
+	if err != nil || len(schools) != 0 {
+		t.Errorf("expect no school in default database, got %v, %v", schools, err)
+	}
+
+	_, err = GetDBNamed(ctx, "unknown")
+	if !errors.Is(err, ErrDBONotRegistered) {
+		t.Errorf("expect ErrDBONotRegistered, got %v", err)
+	}
+}
+
+func TestBaseRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-repo"}, {Name: "school-repo"}, {Name: "school-repo"}}
+	err := repo.InsertInBatches(ctx, schools, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupFixtures[School](t, &SchoolConditions{Name: "school-repo"})
+
+	school, err := repo.Get(ctx, schools[0].ID)
+	if err != nil || school.Name != "school-repo" {
+		t.Errorf("expect school %d, got %v, %v", schools[0].ID, school, err)
+	}
+
+	_, err = repo.Get(ctx, 0)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expect ErrRecordNotFound, got %v", err)
+	}
+
+	err = repo.Insert(ctx, &School{ID: schools[0].ID})
+	if !errors.Is(err, ErrDuplicateRecord) {
+		t.Errorf("expect ErrDuplicateRecord, got %v", err)
+	}
+
+	page, total, err := repo.Page(ctx, &SchoolConditions{Name: "school-repo", Pager: Pager{Page: 1, PageSize: 2}})
+	if err != nil || total != 3 || len(page) != 2 {
+		t.Errorf("expect 2 of 3 schools, got %v, %d, %v", page, total, err)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Student]{}
+	students := []Student{{Name: "student-delete"}, {Name: "student-delete"}, {Name: "student-delete"}}
+	insertFixtures(t, students)
+
+	rowsAffected, err := repo.Delete(ctx, students[0].ID)
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("expect 1 student deleted, got %d, %v", rowsAffected, err)
+	}
+
+	_, err = repo.Get(ctx, students[0].ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expect soft deleted student not found, got %v", err)
+	}
+
+	condition := &ClassConditions{Name: "student-delete"}
+	if count, err := repo.Count(ctx, condition); err != nil || count != 2 {
+		t.Errorf("expect 2 students, got %d, %v", count, err)
+	}
+	if count, err := repo.Count(Unscoped(ctx), condition); err != nil || count != 3 {
+		t.Errorf("expect 3 students including soft deleted, got %d, %v", count, err)
+	}
+
+	_, err = repo.DeleteByConditions(ctx, &ClassConditions{})
+	if !errors.Is(err, ErrMissingConditions) {
+		t.Errorf("expect ErrMissingConditions, got %v", err)
+	}
+
+	rowsAffected, err = repo.DeleteByConditions(Unscoped(ctx), condition)
+	if err != nil || rowsAffected != 3 {
+		t.Errorf("expect 3 students deleted permanently, got %d, %v", rowsAffected, err)
+	}
+	if count, err := repo.Count(Unscoped(ctx), condition); err != nil || count != 0 {
+		t.Errorf("expect no student left, got %d, %v", count, err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	existing := School{Name: "school-upsert"}
+	err := repo.Insert(ctx, &existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupFixtures[School](t, Where().Like("school_name", "school-upsert%"))
+
+	schools := []School{{ID: existing.ID, Name: "school-upsert-ignored"}, {Name: "school-upsert-new"}}
+	result, err := repo.UpsertInBatches(ctx, schools, 10, OnConflictDoNothing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, counted := MustGetDB(ctx).Dialect().(UpsertCounter)
+	if result.Counted != counted || (counted && (result.Inserted != 1 || result.Updated != 0)) {
+		t.Errorf("expect 1 school inserted and existing one kept, got %+v", result)
+	}
+	if count, err := repo.Count(ctx, &SchoolConditions{Name: "school-upsert-new"}); err != nil || count != 1 {
+		t.Errorf("expect new school inserted, got %d, %v", count, err)
+	}
+	if school, err := repo.Get(ctx, existing.ID); err != nil || school.Name != "school-upsert" {
+		t.Errorf("expect existing school kept, got %v, %v", school, err)
+	}
+
+	result, err = repo.Upsert(ctx, &School{ID: existing.ID, Name: "school-upsert-updated"})
+	if err != nil || result.RowsAffected == 0 || result.Counted != counted || (counted && (result.Inserted != 0 || result.Updated != 1)) {
+		t.Errorf("expect 1 school upserted, counted only by dialect splitting rows affected, got %+v, %v", result, err)
+	}
+	if school, err := repo.Get(ctx, existing.ID); err != nil || school.Name != "school-upsert-updated" {
+		t.Errorf("expect existing school updated, got %v, %v", school, err)
+	}
+
+	cases := []struct {
+		rows, rowsAffected, inserted, updated int64
+		exact                                 bool
+	}{
+		{1, 1, 1, 0, true},
+		{1, 2, 0, 1, true},
+		{1, 0, 0, 0, true},
+		{2, 1, 1, 0, true},
+		{3, 5, 1, 2, true},
+		{3, 6, 0, 3, true},
+		{3, 3, 0, 0, false},
+		{3, 4, 0, 0, false},
+	}
+	for _, c := range cases {
+		inserted, updated, exact := MySQLDialect{}.CountUpsert(c.rows, c.rowsAffected)
+		if inserted != c.inserted || updated != c.updated || exact != c.exact {
+			t.Errorf("expect %d inserted, %d updated, exact %v of %d rows affected by %d records, got %d, %d, %v",
+				c.inserted, c.updated, c.exact, c.rowsAffected, c.rows, inserted, updated, exact)
+		}
+	}
+}
+
+// returningSQLiteDialect SQLite with upsert RETURNING, rows named *-new are taken as inserted as SQLite can't tell
+type returningSQLiteDialect struct {
+	SQLiteDialect
+}
+
+func (d returningSQLiteDialect) UpsertInsertedExpr() string {
+	return "(school_name LIKE '%-new')"
+}
+
+func TestUpsertReturning(t *testing.T) {
+	RegisterDialect("sqlite_returning", func() Dialect { return returningSQLiteDialect{} })
+	returningDBO, err := New(WithDBType("sqlite_returning"), WithConnectionString(filepath.Join(t.TempDir(), "returning.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testUpsertReturning(t, returningDBO)
+}
+
+// TestPostgresUpsertReturning set DBO_TEST_POSTGRES_DSN to run upsert against PostgreSQL
+func TestPostgresUpsertReturning(t *testing.T) {
+	dsn := os.Getenv("DBO_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("DBO_TEST_POSTGRES_DSN is not set")
+	}
+
+	postgresDBO, err := New(WithDBType(Postgres), WithConnectionString(dsn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testUpsertReturning(t, postgresDBO)
+}
+
+// testUpsertReturning upsert through create callback of UpsertReturner dialect
+func testUpsertReturning(t *testing.T, dbo *DBO) {
+	ctx := context.Background()
+	err := dbo.db.AutoMigrate(&School{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := dbo.GetDB(ctx)
+	t.Cleanup(func() {
+		_, err := BaseDA{}.DeleteByConditionsTx(Unscoped(ctx), dbo.GetDB(ctx), Where().Like("school_name", "school-returning%"), &School{})
+		if err != nil {
+			t.Errorf("delete fixtures failed: %v", err)
+		}
+	})
+
+	existing := School{Name: "school-returning"}
+	_, err = BaseDA{}.InsertTx(ctx, db, &existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schools := []School{{ID: existing.ID, Name: "school-returning-updated"}, {Name: "school-returning-new"}, {Name: "school-returning-new"}}
+	result, err := BaseDA{}.UpsertInBatchesTx(ctx, db, &schools, 2)
+	if err != nil || !result.Counted || result.RowsAffected != 3 || result.Inserted != 2 || result.Updated != 1 {
+		t.Errorf("expect 2 schools inserted and 1 updated, got %+v, %v", result, err)
+	}
+	if schools[1].ID == 0 || schools[2].ID == 0 || schools[1].ID == schools[2].ID || schools[0].ID != existing.ID {
+		t.Errorf("expect ids of inserted schools returned, got %v", schools)
+	}
+
+	schools = []School{{ID: existing.ID, Name: "school-returning-ignored"}, {Name: "school-returning-new"}}
+	result, err = BaseDA{}.UpsertTx(ctx, db, &schools, OnConflictDoNothing())
+	if err != nil || !result.Counted || result.RowsAffected != 1 || result.Inserted != 1 || result.Updated != 0 {
+		t.Errorf("expect 1 school inserted and existing one kept, got %+v, %v", result, err)
+	}
+	if schools[1].ID == 0 {
+		t.Errorf("expect id of inserted school returned, got %v", schools)
+	}
+
+	var saved School
+	err = BaseDA{}.GetTx(ctx, db, existing.ID, &saved)
+	if err != nil || saved.Name != "school-returning-updated" {
+		t.Errorf("expect existing school updated once, got %v, %v", saved, err)
+	}
+}
+
+func TestUpdateWhere(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Class]{}
+	classes := []Class{{Name: "class-update-where"}, {Name: "class-update-where"}}
+	insertFixtures(t, classes)
+
+	rowsAffected, err := repo.UpdateColumns(ctx, classes[0].ID, map[string]interface{}{"name": "class-update-columns"})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("expect 1 class updated, got %d, %v", rowsAffected, err)
+	}
+
+	_, err = repo.UpdateWhere(ctx, &ClassConditions{}, map[string]interface{}{"name": "class-all"})
+	if !errors.Is(err, ErrMissingConditions) {
+		t.Errorf("expect ErrMissingConditions, got %v", err)
+	}
+
+	rowsAffected, err = repo.UpdateWhere(ctx, &ClassConditions{Name: "class-update-where"}, map[string]interface{}{"name": "class-updated-where"})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("expect 1 class updated, got %d, %v", rowsAffected, err)
+	}
+
+	students := []Student{{Name: "student-update-all"}, {Name: "student-update-all"}}
+	insertFixtures(t, students)
+	rowsAffected, err = BaseRepo[Student]{}.UpdateWhere(Unscoped(ctx), AllRecords, map[string]interface{}{"name": "student-all"})
+	if err != nil || rowsAffected < int64(len(students)) {
+		t.Errorf("expect all students updated, got %d, %v", rowsAffected, err)
+	}
+}
+
+func TestOptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Teacher]{}
+	teacher := Teacher{Name: "teacher-version"}
+	err := repo.Insert(ctx, &teacher)
+	if err != nil || teacher.Version != 1 {
+		t.Fatalf("expect version 1 on insert, got %d, %v", teacher.Version, err)
+	}
+	cleanupFixtures[Teacher](t, Where().Eq("id", teacher.ID))
+
+	stale := teacher
+	teacher.Name = "teacher-version-updated"
+	_, err = repo.Update(ctx, &teacher)
+	if err != nil || teacher.Version != 2 {
+		t.Errorf("expect version 2 on update, got %d, %v", teacher.Version, err)
+	}
+
+	stale.Name = "teacher-version-stale"
+	_, err = repo.Update(ctx, &stale)
+	if !errors.Is(err, ErrStaleRecord) || stale.Version != 1 {
+		t.Errorf("expect ErrStaleRecord and version kept, got %d, %v", stale.Version, err)
+	}
+
+	_, err = repo.UpdateColumns(ctx, teacher.ID, map[string]interface{}{"name": "teacher-version-columns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.Upsert(ctx, &Teacher{ID: teacher.ID, Name: "teacher-version-upsert", Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.Get(ctx, teacher.ID)
+	if err != nil || saved.Name != "teacher-version-upsert" || saved.Version != 4 {
+		t.Errorf("expect version 4 after update columns and upsert, got %+v, %v", saved, err)
+	}
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Enrollment]{}
+	insertFixtures(t, []Enrollment{{StudentID: 1, ClassID: 1, Grade: "A"}, {StudentID: 1, ClassID: 2, Grade: "B"}})
+
+	enrollment, err := repo.Get(ctx, map[string]interface{}{"student_id": 1, "ClassID": 2})
+	if err != nil || enrollment.Grade != "B" {
+		t.Errorf("expect enrollment by map, got %v, %v", enrollment, err)
+	}
+
+	enrollment, err = repo.Get(ctx, struct{ StudentID, ClassID uint }{1, 1})
+	if err != nil || enrollment.Grade != "A" {
+		t.Errorf("expect enrollment by struct, got %v, %v", enrollment, err)
+	}
+
+	for _, id := range []interface{}{1, map[string]interface{}{"student_id": 1}, struct{ StudentID uint }{1}} {
+		_, err = repo.Get(ctx, id)
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("expect ErrInvalidID for %v, got %v", id, err)
+		}
+	}
+
+	rowsAffected, err := repo.UpdateColumns(ctx, Enrollment{StudentID: 1, ClassID: 1}, map[string]interface{}{"grade": "C"})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("expect 1 enrollment updated, got %d, %v", rowsAffected, err)
+	}
+
+	rowsAffected, err = repo.Delete(ctx, map[string]interface{}{"student_id": 1, "class_id": 2})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("expect 1 enrollment deleted, got %d, %v", rowsAffected, err)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-many"}, {Name: "school-many"}, {Name: "school-many"}}
+	insertFixtures(t, schools)
+
+	ids := []interface{}{schools[2].ID, 1 << 30, schools[0].ID, int(schools[1].ID), schools[2].ID}
+	values, missing, err := repo.GetMany(ctx, ids, PreserveOrder(), WithChunkSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values[0].ID != schools[2].ID || values[1].ID != schools[0].ID || values[2].ID != schools[1].ID {
+		t.Errorf("expect schools in order of ids, got %v", values)
+	}
+	if len(missing) != 1 || missing[0] != 1<<30 {
+		t.Errorf("expect missing id, got %v", missing)
+	}
+
+	subjects := []Subject{{Code: "math-many", Name: "math"}, {Code: "art-many", Name: "art"}}
+	insertFixtures(t, subjects)
+	codes := []SubjectCode{"art-many", "music-many", "math-many"}
+	subjectValues, missing, err := BaseRepo[Subject]{}.GetMany(ctx, codes, PreserveOrder())
+	if err != nil || len(subjectValues) != 2 || subjectValues[0].Code != "art-many" || subjectValues[1].Code != "math-many" {
+		t.Errorf("expect subjects found by typed string keys, got %v, %v", subjectValues, err)
+	}
+	if len(missing) != 1 || missing[0] != SubjectCode("music-many") {
+		t.Errorf("expect missing subject code, got %v", missing)
+	}
+
+	_, _, err = BaseRepo[Enrollment]{}.GetMany(ctx, []int{1})
+	if !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expect ErrInvalidID for composite primary key, got %v", err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	insertFixtures(t, []School{{Name: "school-iterate"}, {Name: "school-iterate"}, {Name: "school-iterate"}})
+
+	var names []string
+	err := repo.Iterate(ctx, &SchoolConditions{Name: "school-iterate"}, func(row *School) error {
+		names = append(names, row.Name)
+		return nil
+	})
+	if err != nil || len(names) != 3 {
+		t.Errorf("expect 3 schools iterated, got %v, %v", names, err)
+	}
+
+	errStop := errors.New("stop")
+	var count int
+	err = BaseDA{}.QueryRawSQLIter(ctx, &School{}, func(row interface{}) error {
+		count++
+		if row.(*School).Name != "school-iterate" {
+			t.Errorf("unexpected school %v", row)
+		}
+		return errStop
+	}, "select * from School where school_name = ?", "school-iterate")
+	if !errors.Is(err, errStop) || count != 1 {
+		t.Errorf("expect iteration stopped at first row, got %d, %v", count, err)
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = repo.Iterate(cancelCtx, &SchoolConditions{Name: "school-iterate"}, func(row *School) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect context canceled, got %v", err)
+	}
+
+	err = BaseRepo[ClassWithEnrollments]{}.Iterate(ctx, &classJoinConditions{Preload: true}, func(row *ClassWithEnrollments) error {
+		return nil
+	})
+	if !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("expect ErrUnsupportedCondition for preloads, got %v", err)
+	}
+}
+
+func TestProcessInBatches(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Class]{}
+	classes := make([]Class, 5)
+	for i := range classes {
+		classes[i].Name = "class-batch"
+	}
+	insertFixtures(t, classes)
+
+	errCrash := errors.New("crash")
+	var reported []BatchProgress
+	progress, err := repo.ProcessInBatches(ctx, &ClassConditions{Name: "class-batch"}, 2, func(ctx context.Context, tx *DBContext, batch []Class) error {
+		for _, class := range batch {
+			if class.ID == classes[3].ID {
+				return errCrash
+			}
+
+			_, err := BaseRepo[Class]{}.UpdateColumnsTx(ctx, tx, class.ID, map[string]interface{}{"name": "class-batch-done"})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, WithBatchTransaction(), WithBatchProgress(func(progress BatchProgress) {
+		reported = append(reported, progress)
+	}))
+	if !errors.Is(err, errCrash) || progress.Batches != 1 || progress.Rows != 2 || len(reported) != 1 {
+		t.Fatalf("expect crash after first batch, got %+v, %v", progress, err)
+	}
+
+	// resume after crash, the rolled back batch is processed again
+	var ids []uint
+	progress, err = repo.ProcessInBatches(ctx, &ClassConditions{Name: "class-batch"}, 2, func(ctx context.Context, tx *DBContext, batch []Class) error {
+		for _, class := range batch {
+			ids = append(ids, class.ID)
+		}
+		return nil
+	}, WithStartAfter(progress.LastKey))
+	if err != nil || len(ids) != 3 || ids[0] != classes[2].ID || progress.Batches != 2 {
+		t.Errorf("expect resume from third class, got %v, %+v, %v", ids, progress, err)
+	}
+}
+
+type cursorSchoolConditions struct {
+	SchoolConditions
+	CursorPager CursorPager
+}
+
+func (c *cursorSchoolConditions) GetConditions() ([]string, []interface{}) {
+	return []string{"school_name like ?"}, []interface{}{"school-cursor-%"}
+}
+
+func (c *cursorSchoolConditions) GetCursorPager() *CursorPager {
+	return &c.CursorPager
+}
+
+func TestPageByCursor(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-cursor-a"}, {Name: "school-cursor-b"}, {Name: "school-cursor-b"}, {Name: "school-cursor-c"}, {Name: "school-cursor-d"}}
+	insertFixtures(t, schools)
+
+	for _, sortKeys := range [][]SortKey{nil, {{Column: "Name", Desc: true}}, {{Column: "school_name", Desc: true}, {Column: "id"}}} {
+		condition := &cursorSchoolConditions{CursorPager: CursorPager{PageSize: 2, SortKeys: sortKeys, WithTotal: true}}
+		var pages [][]School
+		var cursorPage CursorPage
+		for {
+			values, page, err := repo.PageByCursor(ctx, condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages = append(pages, values)
+			cursorPage = page
+			if page.NextCursor == "" {
+				break
+			}
+			condition.CursorPager.Cursor = page.NextCursor
+		}
+
+		if len(pages) != 3 || len(pages[2]) != 1 || cursorPage.Total != 5 {
+			t.Fatalf("expect 3 pages of 5 schools sorted by %v, got %v, %+v", sortKeys, pages, cursorPage)
+		}
+
+		var seen []uint
+		for _, page := range pages {
+			for _, school := range page {
+				seen = append(seen, school.ID)
+			}
+		}
+		if len(sortKeys) == 0 && (seen[0] != schools[0].ID || seen[4] != schools[4].ID) {
+			t.Errorf("expect schools sorted by id, got %v", seen)
+		}
+		if len(sortKeys) > 0 && (seen[0] != schools[4].ID || seen[4] != schools[0].ID) {
+			t.Errorf("expect schools sorted by name desc, got %v", seen)
+		}
+
+		condition.CursorPager.Cursor = cursorPage.PrevCursor
+		values, page, err := repo.PageByCursor(ctx, condition)
+		if err != nil || len(values) != 2 || values[0].ID != pages[1][0].ID || values[1].ID != pages[1][1].ID || page.NextCursor == "" || page.PrevCursor == "" {
+			t.Errorf("expect previous page %v, got %v, %+v, %v", pages[1], values, page, err)
+		}
+	}
+
+	invalid := []Conditions{
+		&cursorSchoolConditions{CursorPager: CursorPager{PageSize: 2, Cursor: "bad"}},
+		&cursorSchoolConditions{SchoolConditions: SchoolConditions{Pager: Pager{Page: 1, PageSize: 2}}, CursorPager: CursorPager{PageSize: 2}},
+		Where().OrderBy("id").CursorPager(CursorPager{PageSize: 2}),
+	}
+	for _, condition := range invalid {
+		_, _, err := repo.PageByCursor(ctx, condition)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expect ErrInvalidCursor, got %v", err)
+		}
+	}
+
+	_, _, err := BaseRepo[Student]{}.PageByCursor(ctx, Where().CursorPager(CursorPager{PageSize: 2, SortKeys: []SortKey{{Column: "DeletedAt"}}}))
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expect ErrInvalidCursor for nullable sort key, got %v", err)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-builder-a"}, {Name: "school-builder-b"}, {Name: "school-builder-c"}}
+	insertFixtures(t, schools)
+
+	base := Where().Like("school_name", "school-builder-%")
+	first := base.Eq("school_name", "school-builder-a")
+	either := base.Or(Where().Eq("school_name", "school-builder-b"), Where().Eq("id", schools[2].ID).IsNotNull("school_name"))
+	if wheres, _ := base.GetConditions(); len(wheres) != 1 {
+		t.Errorf("expect base builder untouched, got %v", wheres)
+	}
+	raw := base.Or(Where().Raw("school_name = ? or school_name = ?", "school-builder-a", "school-builder-b").Eq("id", schools[2].ID), Where().IsNull("school_name"))
+	if wheres, _ := raw.GetConditions(); wheres[1] != "(((school_name = ? or school_name = ?) and (id = ?)) or ((school_name is null)))" {
+		t.Errorf("expect raw condition grouped, got %v", wheres)
+	}
+
+	cases := []struct {
+		condition Conditions
+		expect    int
+	}{
+		{base, 3},
+		{first, 1},
+		{either, 2},
+		{base.Ne("school_name", "school-builder-a").Between("id", schools[0].ID, schools[2].ID), 2},
+		{base.In("id", []uint{schools[0].ID, schools[1].ID}), 2},
+		{base.In("id", NullInts{Valid: true}), 0},
+		{base.In("id", NullInts{}), 3},
+		{base.NotIn("id", []uint{}), 3},
+		{base.IsNull("school_name"), 0},
+		{raw, 0},
+	}
+	for _, c := range cases {
+		count, err := repo.Count(ctx, c.condition)
+		if err != nil || count != c.expect {
+			t.Errorf("expect %d schools matching %v, got %d, %v", c.expect, c.condition, count, err)
+		}
+	}
+
+	values, total, err := repo.Page(ctx, base.Select("id").OrderByDesc("id").Pager(1, 2))
+	if err != nil || total != 3 || len(values) != 2 || values[0].ID != schools[2].ID || values[0].Name != "" {
+		t.Errorf("expect first page of selected ids, got %v, %d, %v", values, total, err)
+	}
+}
+
+type predicateSchoolConditions struct {
+	SchoolConditions
+	Predicate Predicate
+}
+
+func (c *predicateSchoolConditions) GetPredicate() Predicate {
+	return c.Predicate
+}
+
+func TestPredicate(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-predicate-a"}, {Name: "school-predicate-b"}, {Name: "school-predicate-c"}}
+	insertFixtures(t, schools)
+
+	predicate := And(
+		Or(Expr("school_name = ?", "school-predicate-a"), Expr("school_name = ?", "school-predicate-b")),
+		Not(Expr("id = ?", schools[0].ID)),
+	)
+	if sql, parameters := predicate.Build(); sql != "(((school_name = ?) or (school_name = ?)) and (not (id = ?)))" || len(parameters) != 3 {
+		t.Errorf("unexpected predicate sql %s, %v", sql, parameters)
+	}
+
+	cases := []struct {
+		condition Conditions
+		expect    int
+	}{
+		{&predicateSchoolConditions{Predicate: predicate}, 1},
+		{&predicateSchoolConditions{SchoolConditions: SchoolConditions{ID: int(schools[1].ID)}, Predicate: predicate}, 1},
+		{&predicateSchoolConditions{SchoolConditions: SchoolConditions{ID: int(schools[2].ID)}, Predicate: predicate}, 0},
+		{&predicateSchoolConditions{SchoolConditions: SchoolConditions{Name: "school-predicate-c"}, Predicate: Or()}, 1},
+		{Where().Like("school_name", "school-predicate-%").Match(Or(Expr("id = ?", schools[0].ID), Expr("id = ?", schools[2].ID))), 2},
+	}
+	for _, c := range cases {
+		count, err := repo.Count(ctx, c.condition)
+		if err != nil || count != c.expect {
+			t.Errorf("expect %d schools matching %v, got %d, %v", c.expect, c.condition, count, err)
+		}
+	}
+}
+
+type ClassWithEnrollments struct {
+	Class
+	Enrollments []Enrollment `gorm:"foreignKey:ClassID"`
+}
+
+func (ClassWithEnrollments) TableName() string {
+	return "class"
+}
+
+type classJoinConditions struct {
+	Grade    string
+	MinCount int
+	Preload  bool
+}
+
+func (c *classJoinConditions) GetConditions() ([]string, []interface{}) {
+	wheres := []string{"class.name like ?"}
+	params := []interface{}{"class-join-%"}
+	if c.Grade != "" {
+		wheres = append(wheres, "enrollment.grade = ?")
+		params = append(params, c.Grade)
+	}
+	return wheres, params
+}
+
+func (c *classJoinConditions) GetPager() *Pager {
+	return &NoPager
+}
+
+func (c *classJoinConditions) GetOrderBy() string {
+	return "class.id"
+}
+
+func (c *classJoinConditions) GetJoins() ([]string, []interface{}) {
+	if c.Preload {
+		return nil, nil
+	}
+	return []string{"join enrollment on enrollment.class_id = class.id"}, nil
+}
+
+func (c *classJoinConditions) GetGroupBy() string {
+	if c.MinCount == 0 {
+		return ""
+	}
+	return "class.id, class.name"
+}
+
+func (c *classJoinConditions) GetHaving() (string, []interface{}) {
+	return "count(*) >= ?", []interface{}{c.MinCount}
+}
+
+func (c *classJoinConditions) GetSelect() []string {
+	if c.MinCount == 0 {
+		return nil
+	}
+	return []string{"class.id", "class.name"}
+}
+
+func (c *classJoinConditions) GetPreloads() []string {
+	if !c.Preload {
+		return nil
+	}
+	return []string{"Enrollments"}
+}
+
+type sortedClassJoinConditions struct {
+	classJoinConditions
+	Sort Sort
+}
+
+func (c *sortedClassJoinConditions) GetSort() Sort {
+	return c.Sort
+}
+
+func TestJoinConditions(t *testing.T) {
+	ctx := context.Background()
+	classes := []Class{{Name: "class-join-a"}, {Name: "class-join-b"}}
+	insertFixtures(t, classes)
+
+	enrollments := []Enrollment{{StudentID: 100, ClassID: classes[0].ID, Grade: "A"}, {StudentID: 101, ClassID: classes[0].ID, Grade: "A"}, {StudentID: 100, ClassID: classes[1].ID, Grade: "B"}}
+	insertFixtures(t, enrollments)
+
+	values, total, err := BaseRepo[Class]{}.Page(ctx, &classJoinConditions{Grade: "A"})
+	if err != nil || total != 2 || len(values) != 2 {
+		t.Errorf("expect 2 joined rows, got %v, %d, %v", values, total, err)
+	}
+
+	values, total, err = BaseRepo[Class]{}.Page(ctx, &classJoinConditions{MinCount: 2})
+	if err != nil || total != 1 || len(values) != 1 || values[0].ID != classes[0].ID {
+		t.Errorf("expect 1 grouped class, got %v, %d, %v", values, total, err)
+	}
+
+	preloaded, err := BaseRepo[ClassWithEnrollments]{}.Query(ctx, &classJoinConditions{Preload: true})
+	if err != nil || len(preloaded) != 2 || len(preloaded[0].Enrollments) != 2 || len(preloaded[1].Enrollments) != 1 {
+		t.Errorf("expect enrollments preloaded, got %v, %v", preloaded, err)
+	}
+
+	sorted := &sortedClassJoinConditions{Sort: Sort{{Column: "enrollment.grade", Desc: true}, {Column: "class.id"}}}
+	values, err = BaseRepo[Class]{}.Query(ctx, sorted)
+	if err != nil || len(values) != 3 || values[0].ID != classes[1].ID {
+		t.Errorf("expect joined rows sorted by grade desc, got %v, %v", values, err)
+	}
+
+	_, err = BaseRepo[Class]{}.Query(ctx, Where().Sort(sorted.Sort))
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expect ErrInvalidSort of column of table not joined, got %v", err)
+	}
+}
+
+type allowedSortConditions struct {
+	Builder
+}
+
+func (c allowedSortConditions) AllowedSortColumns() []string {
+	return []string{"id", "id; drop table School"}
+}
+
+func TestSort(t *testing.T) {
+	sort, err := ParseSort("-school_name, id asc,Name desc")
+	if err != nil || sort.String() != "school_name desc, id, Name desc" {
+		t.Errorf("unexpected sort %v, %v", sort, err)
+	}
+
+	for _, s := range []string{"id; drop table School", "id sideways", "(select 1)", "id desc nulls", "-id desc", "+id asc"} {
+		_, err = ParseSort(s)
+		var sortErr *SortError
+		if !errors.Is(err, ErrInvalidSort) || !errors.As(err, &sortErr) {
+			t.Errorf("expect SortError of %s, got %v", s, err)
+		}
+	}
+
+	ctx := context.Background()
+	repo := BaseRepo[School]{}
+	schools := []School{{Name: "school-sort-a"}, {Name: "school-sort-b"}}
+	insertFixtures(t, schools)
+
+	base := Where().Like("school_name", "school-sort-%").OrderBy("id")
+	values, err := repo.Query(ctx, base.Sort(Sort{{Column: "Name", Desc: true}}))
+	if err != nil || len(values) != 2 || values[0].ID != schools[1].ID {
+		t.Errorf("expect schools sorted by name desc, got %v, %v", values, err)
+	}
+
+	_, err = repo.Query(ctx, base.Sort(Sort{{Column: "unknown"}}))
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expect ErrInvalidSort of unknown column, got %v", err)
+	}
+
+	_, err = repo.Query(ctx, allowedSortConditions{base.Sort(Sort{{Column: "school_name"}})})
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expect ErrInvalidSort of column not allowed, got %v", err)
+	}
+
+	_, err = repo.Query(ctx, allowedSortConditions{base.Sort(Sort{{Column: "id; drop table School"}})})
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expect ErrInvalidSort of allowed column not an identifier, got %v", err)
+	}
+
+	values, err = repo.Query(ctx, allowedSortConditions{base.Sort(Sort{{Column: "id", Desc: true}})})
+	if err != nil || len(values) != 2 || values[0].ID != schools[1].ID {
+		t.Errorf("expect schools sorted by id desc, got %v, %v", values, err)
+	}
+}
+
+type havingConditions struct {
+	Builder
+	GroupBy string
+	Having  string
+	Params  []interface{}
+}
+
+func (c havingConditions) GetGroupBy() string {
+	return c.GroupBy
+}
+
+func (c havingConditions) GetHaving() (string, []interface{}) {
+	return c.Having, c.Params
+}
+
+func TestAggregate(t *testing.T) {
+	ctx := context.Background()
+	repo := BaseRepo[Enrollment]{}
+	enrollments := []Enrollment{{StudentID: 200, ClassID: 200, Grade: "A"}, {StudentID: 201, ClassID: 200, Grade: "B"}, {StudentID: 200, ClassID: 201, Grade: "B"}}
+	insertFixtures(t, enrollments)
+
+	condition := Where().Gte("student_id", 200).Lte("student_id", 201)
+	var summary struct {
+		Total    int
+		Students int
+		MaxClass uint
+		SumClass uint
+		AvgClass float64
+	}
+	err := repo.Aggregate(ctx, condition, AggSpec{Aggs: []Agg{
+		{Func: AggCount, As: "total"},
+		{Func: AggCountDistinct, Column: "StudentID", As: "students"},
+		{Func: AggMax, Column: "class_id", As: "max_class"},
+		{Func: AggSum, Column: "class_id", As: "sum_class"},
+		{Func: AggAvg, Column: "class_id", As: "avg_class"},
+	}}, &summary)
+	if err != nil || summary.Total != 3 || summary.Students != 2 || summary.MaxClass != 201 || summary.SumClass != 601 {
+		t.Errorf("unexpected summary %+v, %v", summary, err)
+	}
+
+	var grades []struct {
+		Grade          string
+		CountStudentID int
+		MinClassID     uint
+	}
+	err = repo.Aggregate(ctx, condition.OrderBy("grade"), AggSpec{
+		Aggs:    []Agg{{Func: AggCount, Column: "student_id"}, {Func: AggMin, Column: "ClassID"}},
+		GroupBy: []string{"Grade"},
+	}, &grades)
+	if err != nil || len(grades) != 2 || grades[1].Grade != "B" || grades[1].CountStudentID != 2 || grades[1].MinClassID != 200 {
+		t.Errorf("unexpected grades %+v, %v", grades, err)
+	}
+
+	byCount := AggSpec{Aggs: []Agg{{Func: AggCount}}, GroupBy: []string{"Grade"}}
+	err = repo.Aggregate(ctx, condition.Sort(Sort{{Column: "count", Desc: true}}), byCount, &grades)
+	if err != nil || len(grades) != 2 || grades[0].Grade != "B" {
+		t.Errorf("expect grades sorted by count desc, got %+v, %v", grades, err)
+	}
+
+	err = repo.Aggregate(ctx, havingConditions{Builder: condition, Having: "count(*) > ?", Params: []interface{}{1}}, byCount, &grades)
+	if err != nil || len(grades) != 1 || grades[0].Grade != "B" {
+		t.Errorf("expect grades having count > 1, got %+v, %v", grades, err)
+	}
+
+	for _, invalid := range []havingConditions{{Builder: condition, GroupBy: "grade"}, {Builder: condition, Having: "count(*) > 1"}} {
+		spec := byCount
+		if invalid.Having != "" {
+			spec.GroupBy = nil
+		}
+		err = repo.Aggregate(ctx, invalid, spec, &summary)
+		if !errors.Is(err, ErrInvalidAggregate) {
+			t.Errorf("expect ErrInvalidAggregate of %+v, got %v", invalid, err)
+		}
+	}
+
+	for _, spec := range []AggSpec{{}, {Aggs: []Agg{{Func: AggSum, Column: "unknown"}}}, {Aggs: []Agg{{Func: "median", Column: "grade"}}}, {Aggs: []Agg{{Func: AggSum, Column: "grade", As: "x;y"}}}} {
+		err = repo.Aggregate(ctx, condition, spec, &summary)
+		if !errors.Is(err, ErrInvalidAggregate) {
+			t.Errorf("expect ErrInvalidAggregate of %+v, got %v", spec, err)
+		}
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	ctx := context.Background()
 	class := Class{ID: 31, Name: "class30"}
@@ -248,6 +1326,210 @@ func TestTrans(t *testing.T) {
 	}
 }
 
+func TestNestedTrans(t *testing.T) {
+	ctx := context.Background()
+	errInner := errors.New("inner failed")
+	cleanupFixtures[School](t, Where().In("school_name", []string{"school-outer", "school-inner-failed", "school-inner"}))
+	err := GetTrans(ctx, func(ctx context.Context, tx *DBContext) error {
+		_, err := BaseDA{}.InsertTx(ctx, tx, &School{Name: "school-outer"})
+		if err != nil {
+			return err
+		}
+
+		err = GetTrans(ctx, func(ctx context.Context, tx *DBContext) error {
+			_, err := BaseDA{}.InsertTx(ctx, tx, &School{Name: "school-inner-failed"})
+			if err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("expect inner error, got %v", err)
+		}
+
+		_, err = GetTransResult(ctx, func(ctx context.Context, tx *DBContext) (interface{}, error) {
+			return BaseDA{}.InsertTx(ctx, tx, &School{Name: "school-inner"})
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expect := range map[string]int{"school-outer": 1, "school-inner-failed": 0, "school-inner": 1} {
+		count, err := BaseDA{}.Count(ctx, &SchoolConditions{Name: name}, &School{})
+		if err != nil || count != expect {
+			t.Errorf("expect %d %s, got %d, %v", expect, name, count, err)
+		}
+	}
+}
+
+type lockedSchoolConditions struct {
+	SchoolConditions
+	Lock Lock
+}
+
+func (c *lockedSchoolConditions) GetLock() Lock {
+	return c.Lock
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	school := School{Name: "school-lock"}
+	_, err := BaseDA{}.Insert(ctx, &school)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupFixtures[School](t, Where().Eq("id", school.ID))
+
+	db, err := GetDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = BaseDA{}.GetWithLockTx(ctx, db, school.ID, &School{}, ForUpdate())
+	if !errors.Is(err, ErrLockOutsideTransaction) {
+		t.Errorf("expect ErrLockOutsideTransaction, got %v", err)
+	}
+
+	condition := &lockedSchoolConditions{SchoolConditions: SchoolConditions{Name: "school-lock"}, Lock: Lock{Mode: LockForShare, SkipLocked: true}}
+	err = GetTrans(ctx, func(ctx context.Context, tx *DBContext) error {
+		locked, err := BaseRepo[School]{}.GetWithLockTx(ctx, tx, school.ID, Lock{Mode: LockForUpdate, NoWait: true})
+		if err != nil || locked.Name != "school-lock" {
+			t.Errorf("expect school locked, got %v, %v", locked, err)
+		}
+
+		var schools []School
+		return BaseDA{}.QueryTx(ctx, tx, condition, &schools)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if locking := condition.Lock.clause(); locking.Strength != "SHARE" || locking.Options != "SKIP LOCKED" {
+		t.Errorf("expect for share skip locked, got %+v", locking)
+	}
+
+	err = GetTrans(ctx, func(ctx context.Context, tx *DBContext) error {
+		total, err := BaseDA{}.PageTx(ctx, tx, condition, &[]School{})
+		if err != nil || total != 1 {
+			t.Errorf("expect 1 school paged with lock, got %d, %v", total, err)
+		}
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, c := range []struct {
+		lock Lock
+		sql  string
+	}{
+		{lock: ForShare(), sql: "LOCK IN SHARE MODE"},
+		{lock: Lock{Mode: LockForShare, NoWait: true}, sql: "FOR SHARE NOWAIT"},
+		{lock: ForUpdate(), sql: "FOR UPDATE"},
+	} {
+		// build without clause builders of SQLite, which ignores lock
+		lockClause := MySQLDialect{}.LockClause(c.lock).(clause.Interface)
+		built := clause.Clause{Name: lockClause.Name()}
+		lockClause.MergeClause(&built)
+		stmt := &gorm.Statement{DB: db.DB}
+		built.Build(stmt)
+		if stmt.SQL.String() != c.sql {
+			t.Errorf("expect %s of MySQL, got %s", c.sql, stmt.SQL.String())
+		}
+	}
+}
+
+func TestTransOptions(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	err := GetTransWithOptions(ctx, func(ctx context.Context, tx *DBContext) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTransTimeout(50*time.Millisecond), WithTransIsolation(sql.LevelSerializable))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expect transaction timeout in 50ms, took %v", time.Since(start))
+	}
+}
+
+func TestTransRetry(t *testing.T) {
+	ctx := context.Background()
+	attempts := 0
+	err := GetTransWithOptions(ctx, func(ctx context.Context, tx *DBContext) error {
+		attempts++
+		if attempts < 3 {
+			return sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		return nil
+	}, WithTransRetry(3), WithTransRetryBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil || attempts != 3 {
+		t.Errorf("expect success after 3 attempts, got %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	errNotRetryable := errors.New("not retryable")
+	err = GetTransWithOptions(ctx, func(ctx context.Context, tx *DBContext) error {
+		attempts++
+		return errNotRetryable
+	}, WithTransRetry(3))
+	if !errors.Is(err, errNotRetryable) || attempts != 1 {
+		t.Errorf("expect no retry, got %d attempts, %v", attempts, err)
+	}
+}
+
+func TestTransTimeoutNoLeak(t *testing.T) {
+	ctx := context.Background()
+	// goroutines of connection pool are created on demand, warm up before counting
+	_, err := BaseDA{}.Count(ctx, &ClassConditions{}, &Class{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroutines := runtime.NumGoroutine()
+
+	fnExited := make(chan error, 1)
+	err = GetTransWithOptions(ctx, func(ctx context.Context, tx *DBContext) error {
+		_, err := BaseDA{}.InsertTx(ctx, tx, &Class{Name: "class-timeout"})
+		if err != nil {
+			return err
+		}
+
+		<-ctx.Done()
+		// keep issuing sql on the rolled back transaction after timeout
+		time.Sleep(20 * time.Millisecond)
+		var classes []Class
+		fnExited <- BaseDA{}.QueryTx(ctx, tx, &ClassConditions{Name: "class-timeout"}, &classes)
+		return nil
+	}, WithTransTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect context.DeadlineExceeded, got %v", err)
+	}
+
+	select {
+	case err = <-fnExited:
+		if err == nil {
+			t.Errorf("expect query on timed out transaction failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transaction fn does not exit")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+		t.Errorf("%d goroutines leaked after transaction timeout", leaked)
+	}
+
+	count, err := BaseDA{}.Count(ctx, &ClassConditions{Name: "class-timeout"}, &Class{})
+	if err != nil || count != 0 {
+		t.Errorf("expect timed out transaction rolled back, got %d, %v", count, err)
+	}
+}
+
 func TestTransNewDB(t *testing.T) {
 	ctx := context.Background()
 	err := GetTrans(ctx, func(ctx context.Context, tx *DBContext) error {
@@ -0,0 +1,199 @@
+package dbo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// BatchOption option of ProcessInBatches
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	transaction  bool
+	transOptions []TransOption
+	progress     func(BatchProgress)
+	startAfter   interface{}
+}
+
+// WithBatchTransaction run each batch in its own transaction, committed when fn of the batch succeeds
+func WithBatchTransaction(options ...TransOption) BatchOption {
+	return func(o *batchOptions) {
+		o.transaction = true
+		o.transOptions = options
+	}
+}
+
+// WithBatchProgress report progress after each batch is processed
+func WithBatchProgress(progress func(BatchProgress)) BatchOption {
+	return func(o *batchOptions) {
+		o.progress = progress
+	}
+}
+
+// WithStartAfter resume processing after primary key, e.g. BatchProgress.LastKey reported before crash
+func WithStartAfter(key interface{}) BatchOption {
+	return func(o *batchOptions) {
+		o.startAfter = key
+	}
+}
+
+// BatchProgress progress of ProcessInBatches
+type BatchProgress struct {
+	// Batches number of batches processed
+	Batches int
+	// Rows number of rows processed
+	Rows int64
+	// LastKey primary key of the last row processed, nil if no row is processed
+	LastKey interface{}
+}
+
+// ProcessInBatches process records matching condition in batches of batchSize ordered by primary key, value is a pointer to model.
+// Batches are paged by primary key instead of offset, so fn may update or delete processed records safely.
+// fn is called with a pointer to slice of model for each batch, and tx is the transaction of the batch if WithBatchTransaction is set.
+// Order and pager of condition are ignored, model must have a single primary key.
+// Return progress of processed batches, processing can be resumed by WithStartAfter(progress.LastKey) after failure
+func (s BaseDA) ProcessInBatches(ctx context.Context, condition Conditions, value interface{}, batchSize int,
+	fn func(ctx context.Context, tx *DBContext, batch interface{}) error, options ...BatchOption) (BatchProgress, error) {
+	batchOptions := &batchOptions{}
+	for _, option := range options {
+		option(batchOptions)
+	}
+
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return BatchProgress{}, err
+	}
+
+	primaryFields, err := db.primaryFields(value)
+	if err == nil && len(primaryFields) > 1 {
+		err = fmt.Errorf("%w: process in batches requires single primary key, got %d", ErrInvalidID, len(primaryFields))
+	}
+	if err == nil && batchSize <= 0 {
+		err = fmt.Errorf("process in batches requires positive batch size, got %d", batchSize)
+	}
+	if err != nil {
+		log.Warn(ctx, "process in batches failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("batchSize", batchSize))
+		return BatchProgress{}, err
+	}
+
+	batch := &keysetBatch{
+		condition:    condition,
+		primaryField: primaryFields[0],
+		batchType:    reflect.SliceOf(reflect.Indirect(reflect.ValueOf(value)).Type()),
+		batchSize:    batchSize,
+		fn:           fn,
+	}
+
+	progress := BatchProgress{LastKey: batchOptions.startAfter}
+	start := time.Now()
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var result *batchResult
+		if batchOptions.transaction {
+			var dbo *DBO
+			dbo, err = GetNamed(s.dbName())
+			if err != nil {
+				break
+			}
+
+			err = dbo.GetTransWithOptions(ctx, func(ctx context.Context, tx *DBContext) error {
+				var batchErr error
+				result, batchErr = batch.process(ctx, tx, progress.LastKey)
+				return batchErr
+			}, batchOptions.transOptions...)
+		} else {
+			result, err = batch.process(ctx, db, progress.LastKey)
+		}
+		if err != nil || result.rows == 0 {
+			break
+		}
+
+		progress.Batches++
+		progress.Rows += int64(result.rows)
+		progress.LastKey = result.lastKey
+		if batchOptions.progress != nil {
+			batchOptions.progress(progress)
+		}
+
+		if result.rows < batchSize {
+			break
+		}
+	}
+
+	if err != nil {
+		log.Warn(ctx, "process in batches failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("batchSize", batchSize),
+			log.Any("progress", progress),
+			log.Duration("duration", time.Since(start)))
+		return progress, err
+	}
+
+	log.Debug(ctx, "process in batches successfully",
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("condition", condition),
+		log.Any("batchSize", batchSize),
+		log.Any("progress", progress),
+		log.Duration("duration", time.Since(start)))
+
+	return progress, nil
+}
+
+// keysetBatch batch of records paged by primary key
+type keysetBatch struct {
+	condition    Conditions
+	primaryField *schema.Field
+	batchType    reflect.Type
+	batchSize    int
+	fn           func(ctx context.Context, tx *DBContext, batch interface{}) error
+}
+
+type batchResult struct {
+	rows    int
+	lastKey interface{}
+}
+
+// process load records after lastKey and call fn with them
+func (s *keysetBatch) process(ctx context.Context, db *DBContext, lastKey interface{}) (*batchResult, error) {
+	db.ResetCondition().applyScope(ctx)
+	db.applyConditions(s.condition)
+
+	column := clause.Column{Table: clause.CurrentTable, Name: s.primaryField.DBName}
+	if lastKey != nil {
+		db.DB = db.Where(clause.Gt{Column: column, Value: lastKey})
+	}
+
+	records := reflect.New(s.batchType)
+	err := db.Order(clause.OrderByColumn{Column: column}).Limit(s.batchSize).Find(records.Interface()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &batchResult{rows: records.Elem().Len()}
+	if result.rows == 0 {
+		return result, nil
+	}
+
+	result.lastKey, _ = s.primaryField.ValueOf(reflect.Indirect(records.Elem().Index(result.rows - 1)))
+	err = s.fn(ctx, db, records.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
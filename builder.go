@@ -0,0 +1,255 @@
+package dbo
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Builder fluent conditions builder implements Conditions.
+// Builder is immutable, every method returns a new builder and leaves the receiver untouched,
+// so a builder is safe to compose and reuse across Query, Count and Page.
+// Column names are written into sql as is and must not come from user input
+type Builder struct {
+	wheres      []string
+	parameters  []interface{}
+	orderBy     []string
+	pager       Pager
+	selects     []string
+	sort        Sort
+	lock        Lock
+	cursorPager *CursorPager
+}
+
+// Where new empty conditions builder
+func Where() Builder {
+	return Builder{}
+}
+
+// Eq column = value
+func (b Builder) Eq(column string, value interface{}) Builder {
+	return b.Raw(column+" = ?", value)
+}
+
+// Ne column <> value
+func (b Builder) Ne(column string, value interface{}) Builder {
+	return b.Raw(column+" <> ?", value)
+}
+
+// Gt column > value
+func (b Builder) Gt(column string, value interface{}) Builder {
+	return b.Raw(column+" > ?", value)
+}
+
+// Gte column >= value
+func (b Builder) Gte(column string, value interface{}) Builder {
+	return b.Raw(column+" >= ?", value)
+}
+
+// Lt column < value
+func (b Builder) Lt(column string, value interface{}) Builder {
+	return b.Raw(column+" < ?", value)
+}
+
+// Lte column <= value
+func (b Builder) Lte(column string, value interface{}) Builder {
+	return b.Raw(column+" <= ?", value)
+}
+
+// In column in values, values is a slice, NullStrings or NullInts.
+// Empty values match nothing, invalid NullStrings/NullInts add no condition
+func (b Builder) In(column string, values interface{}) Builder {
+	slice, ok := inValues(values)
+	if !ok {
+		return b
+	}
+
+	if len(slice) == 0 {
+		return b.Raw("1 = 0")
+	}
+
+	return b.Raw(column+" in (?)", slice)
+}
+
+// NotIn column not in values, values is a slice, NullStrings or NullInts.
+// Empty values and invalid NullStrings/NullInts add no condition
+func (b Builder) NotIn(column string, values interface{}) Builder {
+	slice, ok := inValues(values)
+	if !ok || len(slice) == 0 {
+		return b
+	}
+
+	return b.Raw(column+" not in (?)", slice)
+}
+
+// Like column like pattern
+func (b Builder) Like(column string, pattern string) Builder {
+	return b.Raw(column+" like ?", pattern)
+}
+
+// Between column between from and to
+func (b Builder) Between(column string, from interface{}, to interface{}) Builder {
+	return b.Raw(column+" between ? and ?", from, to)
+}
+
+// IsNull column is null
+func (b Builder) IsNull(column string) Builder {
+	return b.Raw(column + " is null")
+}
+
+// IsNotNull column is not null
+func (b Builder) IsNotNull(column string) Builder {
+	return b.Raw(column + " is not null")
+}
+
+// Raw raw sql condition with parameters
+func (b Builder) Raw(sql string, parameters ...interface{}) Builder {
+	b.wheres = append(b.wheres[:len(b.wheres):len(b.wheres)], sql)
+	b.parameters = append(b.parameters[:len(b.parameters):len(b.parameters)], parameters...)
+	return b
+}
+
+// Match predicate tree matches, see Predicate
+func (b Builder) Match(predicate Predicate) Builder {
+	sql, parameters := predicate.Build()
+	if sql == "" {
+		return b
+	}
+
+	return b.Raw(sql, parameters...)
+}
+
+// Or any of groups matches, conditions of each group are joined by and, empty groups are ignored
+func (b Builder) Or(groups ...Builder) Builder {
+	return b.group(" or ", groups)
+}
+
+// And all of groups match, conditions of each group are joined by and, empty groups are ignored
+func (b Builder) And(groups ...Builder) Builder {
+	return b.group(" and ", groups)
+}
+
+func (b Builder) group(separator string, groups []Builder) Builder {
+	sqls := make([]string, 0, len(groups))
+	var parameters []interface{}
+	for _, group := range groups {
+		if len(group.wheres) == 0 {
+			continue
+		}
+
+		// group each condition, raw sql may contain or
+		sqls = append(sqls, "(("+strings.Join(group.wheres, ") and (")+"))")
+		parameters = append(parameters, group.parameters...)
+	}
+
+	if len(sqls) == 0 {
+		return b
+	}
+
+	return b.Raw("("+strings.Join(sqls, separator)+")", parameters...)
+}
+
+// OrderBy order by column ascending
+func (b Builder) OrderBy(column string) Builder {
+	b.orderBy = append(b.orderBy[:len(b.orderBy):len(b.orderBy)], column)
+	return b
+}
+
+// OrderByDesc order by column descending
+func (b Builder) OrderByDesc(column string) Builder {
+	return b.OrderBy(column + " desc")
+}
+
+// Sort order by validated sort, takes precedence over OrderBy, see Sort
+func (b Builder) Sort(sort Sort) Builder {
+	b.sort = sort
+	return b
+}
+
+// Pager page records, see Pager
+func (b Builder) Pager(page int, pageSize int) Builder {
+	b.pager = Pager{Page: page, PageSize: pageSize}
+	return b
+}
+
+// Select query only columns instead of all fields of model
+func (b Builder) Select(columns ...string) Builder {
+	b.selects = append(b.selects[:len(b.selects):len(b.selects)], columns...)
+	return b
+}
+
+// Lock lock selected rows in transaction, see Lock
+func (b Builder) Lock(lock Lock) Builder {
+	b.lock = lock
+	return b
+}
+
+// CursorPager page records by cursor instead of Pager, see CursorPager
+func (b Builder) CursorPager(cursorPager CursorPager) Builder {
+	b.cursorPager = &cursorPager
+	return b
+}
+
+// GetConditions where conditions joined by and
+func (b Builder) GetConditions() ([]string, []interface{}) {
+	return b.wheres, b.parameters
+}
+
+// GetPager pager of builder
+func (b Builder) GetPager() *Pager {
+	pager := b.pager
+	return &pager
+}
+
+// GetOrderBy order by of builder
+func (b Builder) GetOrderBy() string {
+	return strings.Join(b.orderBy, ", ")
+}
+
+// GetSort sort of builder
+func (b Builder) GetSort() Sort {
+	return b.sort
+}
+
+// GetSelect selected columns of builder
+func (b Builder) GetSelect() []string {
+	return b.selects
+}
+
+// GetLock lock of builder
+func (b Builder) GetLock() Lock {
+	return b.lock
+}
+
+// GetCursorPager cursor pager of builder, nil if not paged by cursor
+func (b Builder) GetCursorPager() *CursorPager {
+	if b.cursorPager == nil {
+		return nil
+	}
+
+	cursorPager := *b.cursorPager
+	return &cursorPager
+}
+
+// inValues values of in condition, false if values is an invalid NullStrings/NullInts
+func inValues(values interface{}) ([]interface{}, bool) {
+	switch v := values.(type) {
+	case NullStrings:
+		return v.ToInterfaceSlice(), v.Valid
+	case NullInts:
+		return v.ToInterfaceSlice(), v.Valid
+	case []interface{}:
+		return v, true
+	}
+
+	reflectValue := reflect.ValueOf(values)
+	if reflectValue.Kind() != reflect.Slice && reflectValue.Kind() != reflect.Array {
+		return []interface{}{values}, true
+	}
+
+	slice := make([]interface{}, reflectValue.Len())
+	for i := range slice {
+		slice[i] = reflectValue.Index(i).Interface()
+	}
+
+	return slice, true
+}
@@ -66,7 +66,7 @@ func insert(ctx context.Context, tx *dbo.DBContext) error {
 }
 
 func delete(ctx context.Context, tx *dbo.DBContext) error {
-	err := tx.Where("id <= ?", batch).Delete(&TestTable{}).Error
+	_, err := dbo.BaseDA{}.DeleteByConditionsTx(ctx, tx, &TestTableConditions{MaxID: batch}, &TestTable{})
 	if err != nil {
 		log.Error(ctx, "delete failed", log.Err(err))
 		return err
@@ -95,3 +95,19 @@ type TestTable struct {
 func (TestTable) TableName() string {
 	return "test_table"
 }
+
+type TestTableConditions struct {
+	MaxID int
+}
+
+func (c *TestTableConditions) GetConditions() ([]string, []interface{}) {
+	return []string{"id <= ?"}, []interface{}{c.MaxID}
+}
+
+func (c *TestTableConditions) GetPager() *dbo.Pager {
+	return &dbo.NoPager
+}
+
+func (c *TestTableConditions) GetOrderBy() string {
+	return ""
+}
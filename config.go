@@ -19,6 +19,14 @@ type Config struct {
 	TransactionTimeout time.Duration
 	LogLevel           LogLevel
 	SlowThreshold      time.Duration
+	// ReplicaConnectionStrings read only replicas of primary database
+	ReplicaConnectionStrings []string
+	ReplicaPolicy            ReplicaPolicy
+	// CancelQueryOnTimeout cancel running statement on server side when transaction times out, e.g. KILL QUERY of MySQL,
+	// it costs one more round trip at the beginning of transaction
+	CancelQueryOnTimeout bool
+	// MaxInClauseSize max number of values in one IN clause, larger lists are queried in chunks, e.g. by GetMany
+	MaxInClauseSize int
 }
 
 func getDefaultConfig() *Config {
@@ -28,8 +36,10 @@ func getDefaultConfig() *Config {
 		ShowSQL:            true,
 		TransactionTimeout: time.Second * 3,
 		// default log level, include INFO & WARN & ERROR logs
-		LogLevel:      Info,
-		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:        Info,
+		SlowThreshold:   200 * time.Millisecond,
+		ReplicaPolicy:   RoundRobin,
+		MaxInClauseSize: defaultMaxInClauseSize,
 	}
 }
 
@@ -83,3 +93,27 @@ func WithLogLevel(logLevel LogLevel) Option {
 		c.LogLevel = logLevel
 	}
 }
+
+func WithReplicas(connectionStrings ...string) Option {
+	return func(c *Config) {
+		c.ReplicaConnectionStrings = connectionStrings
+	}
+}
+
+func WithReplicaPolicy(policy ReplicaPolicy) Option {
+	return func(c *Config) {
+		c.ReplicaPolicy = policy
+	}
+}
+
+func WithMaxInClauseSize(maxInClauseSize int) Option {
+	return func(c *Config) {
+		c.MaxInClauseSize = maxInClauseSize
+	}
+}
+
+func WithCancelQueryOnTimeout(cancelQueryOnTimeout bool) Option {
+	return func(c *Config) {
+		c.CancelQueryOnTimeout = cancelQueryOnTimeout
+	}
+}
@@ -1,6 +1,8 @@
 package dbo
 
 import (
+	"strings"
+
 	"github.com/Klasmart-Engineering/common-log/log"
 	"gorm.io/gorm"
 )
@@ -8,6 +10,8 @@ import (
 // DBContext db with context
 type DBContext struct {
 	*gorm.DB
+	dialect Dialect
+	config  *Config
 }
 
 // Print print sql log
@@ -54,3 +58,169 @@ func (s *DBContext) ResetCondition() *DBContext {
 	s.DB = s.DB.Session(&gorm.Session{NewDB: true})
 	return s
 }
+
+// Dialect get dialect of database, default to MySQL dialect
+func (s *DBContext) Dialect() Dialect {
+	if s.dialect == nil {
+		return MySQLDialect{}
+	}
+
+	return s.dialect
+}
+
+// maxInClauseSize max number of values in one IN clause, see Config.MaxInClauseSize
+func (s *DBContext) maxInClauseSize() int {
+	if s.config == nil || s.config.MaxInClauseSize <= 0 {
+		return defaultMaxInClauseSize
+	}
+
+	return s.config.MaxInClauseSize
+}
+
+// constraintError dbo error of constraint violation, nil if err is not a constraint violation
+func (s *DBContext) constraintError(err error) error {
+	switch classified := s.Dialect().ClassifyError(err); classified {
+	case ErrDuplicateRecord, ErrNotNullViolation, ErrForeignKeyViolation, ErrCheckViolation:
+		return classified
+	default:
+		return nil
+	}
+}
+
+// applyConditions apply where conditions of condition, see whereClause
+func (s *DBContext) applyConditions(condition Conditions) {
+	sql, parameters := whereClause(condition)
+	if sql != "" {
+		s.DB = s.DB.Where(sql, parameters...)
+	}
+}
+
+// applySelect select columns of condition if condition implements SelectConditions
+func (s *DBContext) applySelect(condition Conditions) {
+	selectConditions, ok := condition.(SelectConditions)
+	if !ok {
+		return
+	}
+
+	if columns := selectConditions.GetSelect(); len(columns) > 0 {
+		s.DB = s.DB.Select(columns)
+	}
+}
+
+// applyJoins apply joins of condition if condition implements JoinConditions, return whether any table is joined
+func (s *DBContext) applyJoins(condition Conditions) bool {
+	joinConditions, ok := condition.(JoinConditions)
+	if !ok {
+		return false
+	}
+
+	joins, parameters := joinConditions.GetJoins()
+	if len(joins) == 0 {
+		return false
+	}
+
+	s.DB = s.DB.Joins(strings.Join(joins, " "), parameters...)
+	return true
+}
+
+// applyGroup apply group by and having of condition if condition implements GroupConditions,
+// return group by, empty if not grouped
+func (s *DBContext) applyGroup(condition Conditions) string {
+	groupConditions, ok := condition.(GroupConditions)
+	if !ok {
+		return ""
+	}
+
+	groupBy := groupConditions.GetGroupBy()
+	if groupBy == "" {
+		return ""
+	}
+
+	s.DB = s.DB.Group(groupBy)
+	if having, parameters := groupConditions.GetHaving(); having != "" {
+		s.DB = s.DB.Having(having, parameters...)
+	}
+
+	return groupBy
+}
+
+// applyPreloads preload associations of condition if condition implements PreloadConditions
+func (s *DBContext) applyPreloads(condition Conditions) {
+	preloadConditions, ok := condition.(PreloadConditions)
+	if !ok {
+		return
+	}
+
+	for _, preload := range preloadConditions.GetPreloads() {
+		s.DB = s.DB.Preload(preload)
+	}
+}
+
+// applyOrderAndPager apply order by and pagination of condition, value is the model to validate sort of SortConditions,
+// aliases are result columns allowed to sort by besides fields of model, e.g. aggregate results
+func (s *DBContext) applyOrderAndPager(condition Conditions, value interface{}, aliases ...string) (string, *Pager, error) {
+	orderBy, err := s.applyOrderBy(condition, value, aliases...)
+	if err != nil {
+		return orderBy, nil, err
+	}
+
+	pager := condition.GetPager()
+	if pager != nil && pager.Enable() {
+		// pagination
+		offset, limit := pager.Offset()
+		s.DB = s.DB.Offset(offset).Limit(limit)
+	}
+
+	return orderBy, pager, nil
+}
+
+// applyOrderBy apply validated sort if condition implements SortConditions, otherwise order by string of condition
+func (s *DBContext) applyOrderBy(condition Conditions, value interface{}, aliases ...string) (string, error) {
+	sortConditions, ok := condition.(SortConditions)
+	if !ok || len(sortConditions.GetSort()) == 0 {
+		orderBy := condition.GetOrderBy()
+		if orderBy != "" {
+			s.DB = s.DB.Order(orderBy)
+		}
+
+		return orderBy, nil
+	}
+
+	sort := sortConditions.GetSort()
+	var allowed []string
+	if allower, ok := condition.(SortColumnsAllower); ok {
+		allowed = allower.AllowedSortColumns()
+	}
+
+	var joined bool
+	if joinConditions, ok := condition.(JoinConditions); ok {
+		joins, _ := joinConditions.GetJoins()
+		joined = len(joins) > 0
+	}
+
+	orderByClause, err := s.orderByClause(sort, allowed, joined, aliases, value)
+	if err != nil {
+		return sort.String(), err
+	}
+
+	s.DB = s.DB.Clauses(orderByClause)
+	return sort.String(), nil
+}
+
+// applyRequiredConditions apply where conditions for update and delete,
+// return ErrMissingConditions if there is no condition unless condition allows it explicitly
+func (s *DBContext) applyRequiredConditions(condition Conditions) error {
+	sql, parameters := whereClause(condition)
+	if sql != "" {
+		s.DB = s.DB.Where(sql, parameters...)
+		return nil
+	}
+
+	allower, ok := condition.(EmptyConditionsAllower)
+	if !ok || !allower.AllowEmptyConditions() {
+		return ErrMissingConditions
+	}
+
+	s.DB = s.DB.Session(&gorm.Session{AllowGlobalUpdate: true})
+	return nil
+}
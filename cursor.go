@@ -0,0 +1,356 @@
+package dbo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// SortKey sort column of cursor paging
+type SortKey struct {
+	// Column field name or column name of model
+	Column string
+	Desc   bool
+}
+
+// CursorPager cursor paging setting, records are paged by the values of sort keys instead of offset
+type CursorPager struct {
+	// Cursor opaque cursor of CursorPage, empty for the first page
+	Cursor   string
+	PageSize int
+	// SortKeys sort columns of model, primary keys are appended if missing to make the order unique,
+	// default to primary keys ascending.
+	// Sort keys must not be nullable, as rows with NULL keys never compare greater or less than a cursor,
+	// fields of pointer or sql.NullXXX like types are rejected with ErrInvalidCursor unless tagged not null
+	SortKeys []SortKey
+	// WithTotal count records matching condition, see PageByCursor
+	WithTotal bool
+}
+
+// CursorConditions optional Conditions extension, page records by cursor instead of Pager and order by.
+// Cursor pager is rejected with ErrInvalidCursor if condition sets pager, order by or sort as well
+type CursorConditions interface {
+	GetCursorPager() *CursorPager
+}
+
+// CursorPage result of cursor paging
+type CursorPage struct {
+	// NextCursor cursor of next page, empty if there is no more records
+	NextCursor string
+	// PrevCursor cursor of previous page, empty if it's the first page
+	PrevCursor string
+	// Total number of records matching condition, only counted if CursorPager.WithTotal is set
+	Total int
+}
+
+// PageByCursor query a page of records by cursor, condition must implement CursorConditions
+func (s BaseDA) PageByCursor(ctx context.Context, condition Conditions, values interface{}) (CursorPage, error) {
+	db, err := s.getReadDB(ctx)
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	return s.PageByCursorTx(ctx, db, condition, values)
+}
+
+// PageByCursorTx query a page of records by cursor with db context, condition must implement CursorConditions
+func (s BaseDA) PageByCursorTx(ctx context.Context, db *DBContext, condition Conditions, values interface{}) (CursorPage, error) {
+	cursorPager := conditionCursorPager(condition)
+	if cursorPager == nil {
+		err := fmt.Errorf("%w: condition has no cursor pager", ErrInvalidCursor)
+		log.Warn(ctx, "page by cursor failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(values)),
+			log.Any("condition", condition))
+		return CursorPage{}, err
+	}
+
+	var total int
+	if cursorPager.WithTotal {
+		var err error
+		total, err = s.CountTx(ctx, db, condition, values)
+		if err != nil {
+			return CursorPage{}, err
+		}
+	}
+
+	cursorPage, err := s.query(ctx, db, condition, values)
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	cursorPage.Total = total
+	return *cursorPage, nil
+}
+
+// checkCursorConditions cursor pager replaces pager and order by of condition, reject condition setting both
+func checkCursorConditions(condition Conditions) error {
+	if pager := condition.GetPager(); pager != nil && pager.Enable() {
+		return fmt.Errorf("%w: both cursor pager and pager are set", ErrInvalidCursor)
+	}
+
+	sortConditions, ok := condition.(SortConditions)
+	if condition.GetOrderBy() != "" || (ok && len(sortConditions.GetSort()) > 0) {
+		return fmt.Errorf("%w: both cursor pager and order by are set, use CursorPager.SortKeys instead", ErrInvalidCursor)
+	}
+
+	return nil
+}
+
+// conditionCursorPager cursor pager of condition, nil unless condition implements CursorConditions
+func conditionCursorPager(condition Conditions) *CursorPager {
+	cursorConditions, ok := condition.(CursorConditions)
+	if !ok {
+		return nil
+	}
+
+	return cursorConditions.GetCursorPager()
+}
+
+// cursorKey sort key with field of model
+type cursorKey struct {
+	SortKey
+	field *schema.Field
+}
+
+func (s cursorKey) column() clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: s.field.DBName}
+}
+
+// cursor position of cursor paging, Values are values of sort keys of the boundary record
+type cursor struct {
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// findByCursor find a page of records after or before cursor
+func (s *DBContext) findByCursor(pager *CursorPager, values interface{}) (*CursorPage, error) {
+	if pager.PageSize <= 0 {
+		return nil, fmt.Errorf("%w: page size %d", ErrInvalidCursor, pager.PageSize)
+	}
+
+	records := reflect.Indirect(reflect.ValueOf(values))
+	if records.Kind() != reflect.Slice || !records.CanSet() {
+		return nil, fmt.Errorf("cursor paging requires pointer to slice, got %T", values)
+	}
+
+	keys, err := s.cursorKeys(values, pager.SortKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var backward bool
+	if pager.Cursor != "" {
+		var boundary []interface{}
+		boundary, backward, err = decodeCursor(pager.Cursor, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		s.DB = s.DB.Where(cursorPredicate(keys, boundary, backward))
+	}
+
+	orderBy := clause.OrderBy{Columns: make([]clause.OrderByColumn, 0, len(keys))}
+	for _, key := range keys {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: key.column(), Desc: key.Desc != backward})
+	}
+
+	err = s.DB.Clauses(orderBy).Limit(pager.PageSize + 1).Find(values).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := records.Len() > pager.PageSize
+	if hasMore {
+		records.Set(records.Slice(0, pager.PageSize))
+	}
+
+	if backward {
+		swap := reflect.Swapper(records.Interface())
+		for i, j := 0, records.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	cursorPage := &CursorPage{}
+	if records.Len() == 0 {
+		return cursorPage, nil
+	}
+
+	first, last := reflect.Indirect(records.Index(0)), reflect.Indirect(records.Index(records.Len()-1))
+	if hasMore || backward {
+		if cursorPage.NextCursor, err = encodeCursor(keys, last, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if (hasMore && backward) || (!backward && pager.Cursor != "") {
+		if cursorPage.PrevCursor, err = encodeCursor(keys, first, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return cursorPage, nil
+}
+
+// cursorKeys fields of sort keys, primary keys are appended if missing
+func (s *DBContext) cursorKeys(values interface{}, sortKeys []SortKey) ([]cursorKey, error) {
+	stmt := &gorm.Statement{DB: s.DB}
+	if err := stmt.Parse(values); err != nil {
+		return nil, err
+	}
+
+	keys := make([]cursorKey, 0, len(sortKeys)+len(stmt.Schema.PrimaryFields))
+	sorted := make(map[string]bool, len(sortKeys))
+	for _, sortKey := range sortKeys {
+		field := stmt.Schema.LookUpField(sortKey.Column)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown sort column %s", ErrInvalidCursor, sortKey.Column)
+		}
+		if nullableField(field) {
+			return nil, fmt.Errorf("%w: nullable sort column %s", ErrInvalidCursor, sortKey.Column)
+		}
+
+		keys = append(keys, cursorKey{SortKey: sortKey, field: field})
+		sorted[field.DBName] = true
+	}
+
+	for _, field := range stmt.Schema.PrimaryFields {
+		if sorted[field.DBName] {
+			continue
+		}
+
+		key := cursorKey{SortKey: SortKey{Column: field.DBName}, field: field}
+		if len(keys) > 0 {
+			// keep direction of the last key, so row value comparison still applies
+			key.Desc = keys[len(keys)-1].Desc
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no sort key", ErrInvalidCursor)
+	}
+
+	return keys, nil
+}
+
+// nullableField whether field may hold NULL, i.e. of pointer type or struct type with Valid flag like sql.NullString,
+// and isn't primary key or tagged not null
+func nullableField(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+
+	if field.FieldType.Kind() != reflect.Struct {
+		return false
+	}
+
+	valid, ok := field.FieldType.FieldByName("Valid")
+	return ok && valid.Type.Kind() == reflect.Bool
+}
+
+// cursorPredicate where condition of records after boundary in the order of keys, or before it if backward.
+// (a, b) > (?, ?) if all keys are in the same direction, otherwise (a > ?) OR (a = ? AND b < ?).
+// Keys are never NULL, see nullableField
+func cursorPredicate(keys []cursorKey, boundary []interface{}, backward bool) clause.Expression {
+	operator := func(key cursorKey) string {
+		if key.Desc != backward {
+			return "<"
+		}
+		return ">"
+	}
+
+	sameDirection := true
+	for _, key := range keys {
+		sameDirection = sameDirection && key.Desc == keys[0].Desc
+	}
+
+	vars := make([]interface{}, 0, len(keys)*(len(keys)+1))
+	if sameDirection {
+		placeHolders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+		for _, key := range keys {
+			vars = append(vars, key.column())
+		}
+		vars = append(vars, boundary...)
+
+		return clause.Expr{SQL: fmt.Sprintf("(%s) %s (%s)", placeHolders, operator(keys[0]), placeHolders), Vars: vars}
+	}
+
+	ors := make([]string, 0, len(keys))
+	for i, key := range keys {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, "? = ?")
+			vars = append(vars, keys[j].column(), boundary[j])
+		}
+		ands = append(ands, "? "+operator(key)+" ?")
+		vars = append(vars, key.column(), boundary[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return clause.Expr{SQL: "(" + strings.Join(ors, " OR ") + ")", Vars: vars}
+}
+
+// encodeCursor opaque cursor of record
+func encodeCursor(keys []cursorKey, record reflect.Value, backward bool) (string, error) {
+	c := cursor{Values: make([]json.RawMessage, 0, len(keys)), Backward: backward}
+	for _, key := range keys {
+		value, _ := key.field.ValueOf(record)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+
+		c.Values = append(c.Values, data)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor values of sort keys in cursor, decoded as types of key fields
+func decodeCursor(encoded string, keys []cursorKey) ([]interface{}, bool, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s", ErrInvalidCursor, err.Error())
+	}
+
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, false, fmt.Errorf("%w: %s", ErrInvalidCursor, err.Error())
+	}
+
+	if len(c.Values) != len(keys) {
+		return nil, false, fmt.Errorf("%w: expect %d sort keys, got %d", ErrInvalidCursor, len(keys), len(c.Values))
+	}
+
+	boundary := make([]interface{}, 0, len(keys))
+	for i, key := range keys {
+		value := reflect.New(key.field.FieldType)
+		if err = json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, false, fmt.Errorf("%w: %s", ErrInvalidCursor, err.Error())
+		}
+
+		boundary = append(boundary, value.Elem().Interface())
+	}
+
+	return boundary, c.Backward, nil
+}
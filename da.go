@@ -25,6 +25,14 @@ type Updater interface {
 	UpdateTx(context.Context, *DBContext, interface{}) (int64, error)
 }
 
+// ColumnUpdater partial update contract, update columns by id or by conditions
+type ColumnUpdater interface {
+	UpdateColumns(context.Context, interface{}, interface{}, map[string]interface{}) (int64, error)
+	UpdateColumnsTx(context.Context, *DBContext, interface{}, interface{}, map[string]interface{}) (int64, error)
+	UpdateWhere(context.Context, Conditions, interface{}, map[string]interface{}) (int64, error)
+	UpdateWhereTx(context.Context, *DBContext, Conditions, interface{}, map[string]interface{}) (int64, error)
+}
+
 type Saver interface {
 	Save(context.Context, interface{}) error
 	SaveTx(context.Context, *DBContext, interface{}) error
@@ -35,6 +43,12 @@ type Geter interface {
 	GetTx(context.Context, *DBContext, interface{}, interface{}) error
 }
 
+// ManyGeter get records by ids contract
+type ManyGeter interface {
+	GetMany(context.Context, interface{}, interface{}, ...GetManyOption) ([]interface{}, error)
+	GetManyTx(context.Context, *DBContext, interface{}, interface{}, ...GetManyOption) ([]interface{}, error)
+}
+
 type Querier interface {
 	Query(context.Context, Conditions, interface{}) error
 	QueryTx(context.Context, *DBContext, Conditions, interface{}) error
@@ -46,8 +60,65 @@ type Querier interface {
 	QueryRawSQLTx(context.Context, *DBContext, interface{}, string, ...interface{}) error
 }
 
+// Deleter delete contract, kept out of DataAccesser so existing implementers of DataAccesser don't break
+type Deleter interface {
+	Delete(context.Context, interface{}, interface{}) (int64, error)
+	DeleteTx(context.Context, *DBContext, interface{}, interface{}) (int64, error)
+	DeleteByConditions(context.Context, Conditions, interface{}) (int64, error)
+	DeleteByConditionsTx(context.Context, *DBContext, Conditions, interface{}) (int64, error)
+}
+
 type Conditions interface {
 	GetConditions() ([]string, []interface{})
 	GetPager() *Pager
 	GetOrderBy() string
 }
+
+// EmptyConditionsAllower optional Conditions extension,
+// allow UpdateWhere and DeleteByConditions to run without conditions, i.e. on the whole table
+type EmptyConditionsAllower interface {
+	AllowEmptyConditions() bool
+}
+
+// SelectConditions optional Conditions extension, query only selected columns instead of all fields of model
+type SelectConditions interface {
+	GetSelect() []string
+}
+
+// JoinConditions optional Conditions extension, join other tables, e.g. "left join class on class.id = student.class_id".
+// Joins are written into sql in order with parameters
+type JoinConditions interface {
+	GetJoins() ([]string, []interface{})
+}
+
+// PreloadConditions optional Conditions extension, preload associations of model by gorm, see https://gorm.io/docs/preload.html
+type PreloadConditions interface {
+	GetPreloads() []string
+}
+
+// GroupConditions optional Conditions extension, group by and having, having is ignored if group by is empty
+type GroupConditions interface {
+	GetGroupBy() string
+	GetHaving() (string, []interface{})
+}
+
+type allRecords struct{}
+
+func (allRecords) GetConditions() ([]string, []interface{}) {
+	return nil, nil
+}
+
+func (allRecords) GetPager() *Pager {
+	return &NoPager
+}
+
+func (allRecords) GetOrderBy() string {
+	return ""
+}
+
+func (allRecords) AllowEmptyConditions() bool {
+	return true
+}
+
+// AllRecords conditions matching all records of table, explicitly allow UpdateWhere and DeleteByConditions on the whole table
+var AllRecords Conditions = allRecords{}
@@ -5,19 +5,24 @@ type DBType string
 const (
 	MySQL         DBType = "mysql"
 	NewRelicMySQL DBType = "newrelic_mysql"
+	// SQLite file-backed or in-memory database, for local development and unit tests.
+	// notice: every connection opens its own ":memory:" database, use "file::memory:?cache=shared"
+	// or MaxOpenConns 1 to share an in-memory database between connections
+	SQLite DBType = "sqlite"
+	// Postgres PostgreSQL database via pgx driver
+	Postgres DBType = "postgres"
 )
 
 func (t DBType) String() string {
 	return string(t)
 }
 
+// DriverName database/sql driver name of registered dialect, empty if not registered
 func (t DBType) DriverName() string {
-	switch t {
-	case MySQL:
-		return "mysql"
-	case NewRelicMySQL:
-		return "nrmysql"
-	default:
+	dialect, err := GetDialect(t)
+	if err != nil {
 		return ""
 	}
+
+	return dialect.DriverName()
 }
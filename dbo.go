@@ -1,26 +1,28 @@
 package dbo
 
 import (
-	// mysql driver
 	"context"
 	"sync"
 
 	"github.com/Klasmart-Engineering/common-log/log"
-	_ "github.com/newrelic/go-agent/v3/integrations/nrmysql"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// DefaultName name of the global dbo instance
+const DefaultName = "default"
+
 var (
-	globalDBO   *DBO
+	namedDBOs   = map[string]*DBO{}
 	globalMutex sync.Mutex
 )
 
 // DBO database operator
 type DBO struct {
-	db     *gorm.DB
-	config *Config
+	db       *gorm.DB
+	config   *Config
+	dialect  Dialect
+	replicas *replicaSet
 }
 
 // MustGetDB get db context otherwise panic
@@ -35,7 +37,17 @@ func MustGetDB(ctx context.Context) *DBContext {
 
 // GetDB get db context
 func GetDB(ctx context.Context) (*DBContext, error) {
-	dbo, err := GetGlobal()
+	return GetDBNamed(ctx, DefaultName)
+}
+
+// GetReadDB get db context for read only queries, see DBO.GetReadDB
+func GetReadDB(ctx context.Context) (*DBContext, error) {
+	return GetReadDBNamed(ctx, DefaultName)
+}
+
+// GetDBNamed get db context of named dbo instance
+func GetDBNamed(ctx context.Context, name string) (*DBContext, error) {
+	dbo, err := GetNamed(name)
 	if err != nil {
 		return nil, err
 	}
@@ -43,29 +55,56 @@ func GetDB(ctx context.Context) (*DBContext, error) {
 	return dbo.GetDB(ctx), nil
 }
 
+// GetReadDBNamed get db context of named dbo instance for read only queries, see DBO.GetReadDB
+func GetReadDBNamed(ctx context.Context, name string) (*DBContext, error) {
+	dbo, err := GetNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbo.GetReadDB(ctx), nil
+}
+
 // ReplaceGlobal replace global dbo instance
 func ReplaceGlobal(dbo *DBO) {
+	Register(DefaultName, dbo)
+}
+
+// GetGlobal get global dbo
+func GetGlobal() (*DBO, error) {
+	return GetNamed(DefaultName)
+}
+
+// Register register dbo instance with name, replace the existing one if any
+func Register(name string, dbo *DBO) {
 	globalMutex.Lock()
 	defer globalMutex.Unlock()
 
-	globalDBO = dbo
+	namedDBOs[name] = dbo
 }
 
-// GetGlobal get global dbo
-func GetGlobal() (*DBO, error) {
+// GetNamed get dbo instance registered with name, the default instance is created with default config if not registered
+func GetNamed(name string) (*DBO, error) {
 	globalMutex.Lock()
 	defer globalMutex.Unlock()
 
-	if globalDBO == nil {
-		dbo, err := New()
-		if err != nil {
-			return nil, err
-		}
+	dbo, ok := namedDBOs[name]
+	if ok && dbo != nil {
+		return dbo, nil
+	}
 
-		globalDBO = dbo
+	if name != DefaultName {
+		log.Warn(context.Background(), "dbo not registered", log.String("name", name))
+		return nil, ErrDBONotRegistered
 	}
 
-	return globalDBO, nil
+	dbo, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	namedDBOs[name] = dbo
+	return dbo, nil
 }
 
 // New create new database operator
@@ -83,32 +122,70 @@ func NewWithConfig(options ...Option) (*DBO, error) {
 	}
 
 	ctx := context.Background()
-	var db *gorm.DB
-	var err error
-	switch config.DBType {
-	case MySQL, NewRelicMySQL:
-		db, err = gorm.Open(mysql.New(mysql.Config{
-			DriverName: config.DBType.DriverName(),
-			DSN:        config.ConnectionString,
-		}), &gorm.Config{QueryFields: true})
-	default:
-		log.Panic(ctx, "unsupported database type", log.String("databaseType", config.DBType.String()))
+	dialect, err := GetDialect(config.DBType)
+	if err != nil {
+		log.Warn(ctx, "unsupported database type",
+			log.Err(err),
+			log.String("databaseType", config.DBType.String()))
+		return nil, err
 	}
 
+	db, err := openDB(ctx, config, dialect, config.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*gorm.DB, 0, len(config.ReplicaConnectionStrings))
+	for _, connectionString := range config.ReplicaConnectionStrings {
+		replica, err := openDB(ctx, config, dialect, connectionString)
+		if err != nil {
+			closeDB(db)
+			for _, opened := range replicas {
+				closeDB(opened)
+			}
+			return nil, err
+		}
+
+		replicas = append(replicas, replica)
+	}
+
+	return &DBO{
+		db:       db,
+		config:   config,
+		dialect:  dialect,
+		replicas: newReplicaSet(replicas, config.ReplicaPolicy),
+	}, nil
+}
+
+// openDB open database connection pool of dsn
+func openDB(ctx context.Context, config *Config, dialect Dialect, connectionString string) (*gorm.DB, error) {
+	db, err := gorm.Open(dialect.Dialector(connectionString), &gorm.Config{QueryFields: true})
 	if err != nil {
 		log.Warn(ctx, "init database connection failed",
 			log.Err(err),
 			log.String("databaseType", config.DBType.String()),
-			log.String("connectionString", config.ConnectionString))
+			log.String("connectionString", connectionString))
 		return nil, err
 	}
 
+	if returner, ok := dialect.(UpsertReturner); ok {
+		err = registerUpsertReturning(db, returner)
+		if err != nil {
+			log.Warn(ctx, "register upsert callback failed",
+				log.Err(err),
+				log.String("databaseType", config.DBType.String()),
+				log.String("connectionString", connectionString))
+			closeDB(db)
+			return nil, err
+		}
+	}
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		log.Warn(ctx, "get DB failed",
 			log.Err(err),
 			log.String("databaseType", config.DBType.String()),
-			log.String("connectionString", config.ConnectionString))
+			log.String("connectionString", connectionString))
 		return nil, err
 	}
 
@@ -117,7 +194,8 @@ func NewWithConfig(options ...Option) (*DBO, error) {
 		log.Warn(ctx, "ping datebase failed",
 			log.Err(err),
 			log.String("databaseType", config.DBType.String()),
-			log.String("connectionString", config.ConnectionString))
+			log.String("connectionString", connectionString))
+		sqlDB.Close()
 		return nil, err
 	}
 
@@ -137,15 +215,41 @@ func NewWithConfig(options ...Option) (*DBO, error) {
 		sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
 	}
 
-	return &DBO{db, config}, nil
+	return db, nil
+}
+
+func closeDB(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
 }
 
+// GetDB get db context of primary database
 func (s DBO) GetDB(ctx context.Context) *DBContext {
-	ctxDB := &DBContext{DB: s.db.Session(&gorm.Session{
-		Context:     ctx,
-		NewDB:       true,
-		QueryFields: true,
-	})}
+	return s.newDBContext(ctx, s.db)
+}
+
+// GetReadDB get db context of replica database for read only queries,
+// use primary database if there is no replica or ctx is marked by ForcePrimary
+func (s DBO) GetReadDB(ctx context.Context) *DBContext {
+	if s.replicas == nil || isForcePrimary(ctx) {
+		return s.GetDB(ctx)
+	}
+
+	return s.newDBContext(ctx, s.replicas.next())
+}
+
+func (s DBO) newDBContext(ctx context.Context, db *gorm.DB) *DBContext {
+	ctxDB := &DBContext{
+		DB: db.Session(&gorm.Session{
+			Context:     ctx,
+			NewDB:       true,
+			QueryFields: true,
+		}),
+		dialect: s.dialect,
+		config:  s.config,
+	}
 
 	ctxDB.Logger = logger.New(ctxDB, logger.Config{
 		LogLevel:                  s.config.LogLevel.GormLogLevel(),
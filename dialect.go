@@ -0,0 +1,64 @@
+package dbo
+
+import (
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnsupportedDBType no dialect registered for database type
+var ErrUnsupportedDBType = errors.New("unsupported database type")
+
+// Dialect database specific behaviors, bind variables and identifier quoting are left to gorm Dialector
+type Dialect interface {
+	// Dialector gorm dialector to open dsn with
+	Dialector(dsn string) gorm.Dialector
+	// DriverName database/sql driver name
+	DriverName() string
+	// ClassifyError translate driver error to dbo error, return nil if err is not recognized
+	ClassifyError(err error) error
+}
+
+// QueryCanceler optional Dialect extension, cancel running statement of a connection on server side,
+// used when Config.CancelQueryOnTimeout is enabled
+type QueryCanceler interface {
+	// ConnectionID server side id of the connection which tx runs on
+	ConnectionID(tx *gorm.DB) (int64, error)
+	// CancelQuery cancel running statement of connection by another connection of db
+	CancelQuery(db *gorm.DB, connectionID int64) error
+}
+
+// DialectFactory create dialect
+type DialectFactory func() Dialect
+
+var (
+	dialects = map[DBType]DialectFactory{
+		MySQL:         func() Dialect { return MySQLDialect{Driver: "mysql"} },
+		NewRelicMySQL: func() Dialect { return MySQLDialect{Driver: "nrmysql"} },
+		SQLite:        func() Dialect { return SQLiteDialect{} },
+		Postgres:      func() Dialect { return PostgresDialect{} },
+	}
+	dialectMutex sync.RWMutex
+)
+
+// RegisterDialect register dialect of database type, replace the existing one if any
+func RegisterDialect(dbType DBType, factory DialectFactory) {
+	dialectMutex.Lock()
+	defer dialectMutex.Unlock()
+
+	dialects[dbType] = factory
+}
+
+// GetDialect get dialect of database type
+func GetDialect(dbType DBType) (Dialect, error) {
+	dialectMutex.RLock()
+	defer dialectMutex.RUnlock()
+
+	factory, ok := dialects[dbType]
+	if !ok {
+		return nil, ErrUnsupportedDBType
+	}
+
+	return factory(), nil
+}
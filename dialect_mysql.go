@@ -0,0 +1,111 @@
+package dbo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	// newrelic mysql driver
+	_ "github.com/newrelic/go-agent/v3/integrations/nrmysql"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MySQLDialect MySQL and compatible databases, e.g. TiDB, MariaDB
+type MySQLDialect struct {
+	// Driver database/sql driver name, e.g. "mysql", "nrmysql"
+	Driver string
+}
+
+func (d MySQLDialect) Dialector(dsn string) gorm.Dialector {
+	return gormmysql.New(gormmysql.Config{
+		DriverName: d.DriverName(),
+		DSN:        dsn,
+	})
+}
+
+func (d MySQLDialect) DriverName() string {
+	if d.Driver == "" {
+		return "mysql"
+	}
+
+	return d.Driver
+}
+
+func (d MySQLDialect) ClassifyError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return nil
+	}
+
+	switch mysqlErr.Number {
+	case 1062:
+		return ErrDuplicateRecord
+	case 1048:
+		return ErrNotNullViolation
+	case 1451, 1452:
+		return ErrForeignKeyViolation
+	case 3819:
+		return ErrCheckViolation
+	case 1213:
+		return ErrDeadlock
+	case 1205:
+		return ErrLockWaitTimeout
+	default:
+		return nil
+	}
+}
+
+func (d MySQLDialect) ConnectionID(tx *gorm.DB) (int64, error) {
+	var connectionID int64
+	err := tx.Raw("SELECT CONNECTION_ID()").Scan(&connectionID).Error
+	return connectionID, err
+}
+
+func (d MySQLDialect) CancelQuery(db *gorm.DB, connectionID int64) error {
+	return db.Exec(fmt.Sprintf("KILL QUERY %d", connectionID)).Error
+}
+
+// CountUpsert MySQL reports 1 affected row per inserted record, 2 per updated one and 0 per unchanged one,
+// the split is exact only if a pair of unchanged and updated records can't pass for 2 inserted ones,
+// e.g. 3 rows affected by 3 records are either 3 inserted or 1 inserted, 1 updated and 1 unchanged
+func (d MySQLDialect) CountUpsert(rows int64, rowsAffected int64) (int64, int64, bool) {
+	updated := rowsAffected - rows
+	if updated < 0 {
+		updated = 0
+	}
+
+	if updated != rowsAffected/2 {
+		return 0, 0, false
+	}
+
+	return rowsAffected - 2*updated, updated, true
+}
+
+// LockClause MySQL 5.7 doesn't support FOR SHARE, use LOCK IN SHARE MODE for shared lock without NOWAIT/SKIP LOCKED,
+// which require MySQL 8.0 and FOR SHARE
+func (d MySQLDialect) LockClause(lock Lock) clause.Expression {
+	if lock.Mode == LockForShare && !lock.NoWait && !lock.SkipLocked {
+		return lockInShareMode{}
+	}
+
+	return lock.clause()
+}
+
+// lockInShareMode shared row lock clause of MySQL
+type lockInShareMode struct{}
+
+func (lockInShareMode) Name() string {
+	return "FOR"
+}
+
+func (lockInShareMode) Build(builder clause.Builder) {
+	builder.WriteString("LOCK IN SHARE MODE")
+}
+
+func (l lockInShareMode) MergeClause(c *clause.Clause) {
+	// clear name to avoid "FOR LOCK IN SHARE MODE"
+	c.Name = ""
+	c.Expression = l
+}
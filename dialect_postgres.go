@@ -0,0 +1,65 @@
+package dbo
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// PostgresDialect PostgreSQL database via pgx driver
+type PostgresDialect struct{}
+
+func (d PostgresDialect) Dialector(dsn string) gorm.Dialector {
+	// keep DriverName empty so that gorm parses dsn with pgx, e.g. TimeZone setting
+	return postgres.New(postgres.Config{
+		DSN: dsn,
+	})
+}
+
+func (d PostgresDialect) DriverName() string {
+	return "pgx"
+}
+
+func (d PostgresDialect) ClassifyError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	// https://www.postgresql.org/docs/current/errcodes-appendix.html
+	switch pgErr.Code {
+	case "23505":
+		return ErrDuplicateRecord
+	case "23502":
+		return ErrNotNullViolation
+	case "23503":
+		return ErrForeignKeyViolation
+	case "23514":
+		return ErrCheckViolation
+	case "40P01":
+		return ErrDeadlock
+	case "55P03":
+		return ErrLockWaitTimeout
+	case "40001":
+		return ErrSerializationFailure
+	default:
+		return nil
+	}
+}
+
+func (d PostgresDialect) ConnectionID(tx *gorm.DB) (int64, error) {
+	var connectionID int64
+	err := tx.Raw("SELECT pg_backend_pid()").Scan(&connectionID).Error
+	return connectionID, err
+}
+
+func (d PostgresDialect) CancelQuery(db *gorm.DB, connectionID int64) error {
+	return db.Exec("SELECT pg_cancel_backend(?)", connectionID).Error
+}
+
+// UpsertInsertedExpr xmax of a row is 0 unless the row is updated or locked, as ON CONFLICT DO UPDATE does
+func (d PostgresDialect) UpsertInsertedExpr() string {
+	return "(xmax = 0)"
+}
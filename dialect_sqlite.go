@@ -0,0 +1,48 @@
+package dbo
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SQLiteDialect SQLite database
+type SQLiteDialect struct{}
+
+func (d SQLiteDialect) Dialector(dsn string) gorm.Dialector {
+	return &sqlite.Dialector{
+		DriverName: d.DriverName(),
+		DSN:        dsn,
+	}
+}
+
+func (d SQLiteDialect) DriverName() string {
+	return sqlite.DriverName
+}
+
+func (d SQLiteDialect) ClassifyError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return ErrDuplicateRecord
+	case sqlite3.ErrConstraintNotNull:
+		return ErrNotNullViolation
+	case sqlite3.ErrConstraintForeignKey:
+		return ErrForeignKeyViolation
+	case sqlite3.ErrConstraintCheck:
+		return ErrCheckViolation
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return ErrLockWaitTimeout
+	default:
+		return nil
+	}
+}
@@ -9,4 +9,34 @@ var (
 	ErrDuplicateRecord = errors.New("duplicate record")
 	// ErrExceededLimit exceeded limit
 	ErrExceededLimit = errors.New("exceeded limit")
+	// ErrNotNullViolation null value in not null column
+	ErrNotNullViolation = errors.New("not null violation")
+	// ErrForeignKeyViolation foreign key constraint violation
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrCheckViolation check constraint violation
+	ErrCheckViolation = errors.New("check violation")
+	// ErrDeadlock deadlock detected
+	ErrDeadlock = errors.New("deadlock")
+	// ErrLockWaitTimeout lock wait timeout exceeded
+	ErrLockWaitTimeout = errors.New("lock wait timeout")
+	// ErrSerializationFailure could not serialize access due to concurrent update
+	ErrSerializationFailure = errors.New("serialization failure")
+	// ErrMissingConditions refuse to update or delete without conditions
+	ErrMissingConditions = errors.New("missing conditions")
+	// ErrStaleRecord record modified or deleted since loaded, see BaseDA.UpdateTx
+	ErrStaleRecord = errors.New("stale record")
+	// ErrLockOutsideTransaction row lock is only allowed in transaction
+	ErrLockOutsideTransaction = errors.New("lock outside transaction")
+	// ErrInvalidID id doesn't match primary key(s) of model
+	ErrInvalidID = errors.New("invalid id")
+	// ErrInvalidCursor malformed cursor or cursor pager
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort invalid sort column or direction, see SortError
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidAggregate invalid aggregate spec
+	ErrInvalidAggregate = errors.New("invalid aggregate")
+	// ErrUnsupportedCondition condition extension not supported by the operation, e.g. preloads of Iterate
+	ErrUnsupportedCondition = errors.New("unsupported condition")
+	// ErrDBONotRegistered no dbo instance registered with name
+	ErrDBONotRegistered = errors.New("dbo not registered")
 )
@@ -0,0 +1,237 @@
+package dbo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const defaultMaxInClauseSize = 1000
+
+// GetManyOption option of GetMany
+type GetManyOption func(*getManyOptions)
+
+type getManyOptions struct {
+	preserveOrder bool
+	chunkSize     int
+}
+
+// PreserveOrder return records in the order of ids, records are in database order by default
+func PreserveOrder() GetManyOption {
+	return func(o *getManyOptions) {
+		o.preserveOrder = true
+	}
+}
+
+// WithChunkSize max number of ids per query, default to Config.MaxInClauseSize
+func WithChunkSize(chunkSize int) GetManyOption {
+	return func(o *getManyOptions) {
+		o.chunkSize = chunkSize
+	}
+}
+
+// GetMany get records by ids, ids is a slice of primary key values and values is a pointer to slice of model.
+// Model must have a single primary key, return ids not found
+func (s BaseDA) GetMany(ctx context.Context, ids interface{}, values interface{}, options ...GetManyOption) ([]interface{}, error) {
+	db, err := s.getReadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetManyTx(ctx, db, ids, values, options...)
+}
+
+// GetManyTx get records by ids with db context, ids is a slice of primary key values and values is a pointer to slice of model.
+// Model must have a single primary key, return ids not found
+func (s BaseDA) GetManyTx(ctx context.Context, db *DBContext, ids interface{}, values interface{}, options ...GetManyOption) ([]interface{}, error) {
+	getManyOptions := &getManyOptions{chunkSize: db.maxInClauseSize()}
+	for _, option := range options {
+		option(getManyOptions)
+	}
+	if getManyOptions.chunkSize <= 0 {
+		getManyOptions.chunkSize = db.maxInClauseSize()
+	}
+
+	primaryFields, err := db.primaryFields(values)
+	if err == nil && len(primaryFields) > 1 {
+		err = fmt.Errorf("%w: get many requires single primary key, got %d", ErrInvalidID, len(primaryFields))
+	}
+	if err != nil {
+		log.Warn(ctx, "get many failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(values)),
+			log.Any("ids", ids))
+		return nil, err
+	}
+	primaryField := primaryFields[0]
+
+	keys, keyValues, err := uniqueKeys(primaryField, ids)
+	if err != nil {
+		log.Warn(ctx, "get many failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(values)),
+			log.Any("ids", ids))
+		return nil, err
+	}
+
+	reflectValues := reflect.Indirect(reflect.ValueOf(values))
+	if reflectValues.Kind() != reflect.Slice || !reflectValues.CanSet() {
+		return nil, fmt.Errorf("get many requires pointer to slice, got %T", values)
+	}
+
+	start := time.Now()
+	records := reflect.MakeSlice(reflectValues.Type(), 0, len(keys))
+	for begin := 0; begin < len(keys); begin += getManyOptions.chunkSize {
+		end := begin + getManyOptions.chunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		chunk := reflect.New(reflectValues.Type())
+		err = db.ResetCondition().applyScope(ctx).
+			Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: primaryField.DBName}, Values: keyValues[begin:end]}).
+			Find(chunk.Interface()).Error
+		if err != nil {
+			log.Warn(ctx, "get many failed",
+				log.Err(err),
+				log.String("tableName", db.GetTableName(values)),
+				log.Any("ids", keys[begin:end]),
+				log.Duration("duration", time.Since(start)))
+			return nil, err
+		}
+
+		records = reflect.AppendSlice(records, chunk.Elem())
+	}
+
+	// match records to ids by primary key values in the go type of primary field,
+	// then case insensitively for string keys matched by case insensitive collation
+	found := make(map[interface{}]int, records.Len())
+	foldFound := make(map[string]int)
+	for i := 0; i < records.Len(); i++ {
+		key, _ := primaryField.ValueOf(reflect.Indirect(records.Index(i)))
+		found[comparableKey(key)] = i
+		if foldKey, ok := comparableKey(key).(string); ok {
+			foldFound[strings.ToLower(foldKey)] = i
+		}
+	}
+
+	var missing []interface{}
+	ordered := reflect.MakeSlice(reflectValues.Type(), 0, records.Len())
+	for i, key := range keys {
+		index, ok := found[comparableKey(keyValues[i])]
+		if foldKey, isString := comparableKey(keyValues[i]).(string); !ok && isString {
+			index, ok = foldFound[strings.ToLower(foldKey)]
+		}
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		ordered = reflect.Append(ordered, records.Index(index))
+	}
+
+	if getManyOptions.preserveOrder {
+		records = ordered
+	}
+	reflectValues.Set(records)
+
+	log.Debug(ctx, "get many successfully",
+		log.String("tableName", db.GetTableName(values)),
+		log.Any("count", len(keys)),
+		log.Any("missing", missing),
+		log.Duration("duration", time.Since(start)))
+
+	return missing, nil
+}
+
+// uniqueKeys distinct ids in order and their values converted to the go type of primary field
+func uniqueKeys(primaryField *schema.Field, ids interface{}) ([]interface{}, []interface{}, error) {
+	reflectIDs := reflect.Indirect(reflect.ValueOf(ids))
+	if reflectIDs.Kind() != reflect.Slice && reflectIDs.Kind() != reflect.Array {
+		return nil, nil, fmt.Errorf("%w: expect slice of ids, got %T", ErrInvalidID, ids)
+	}
+
+	keys := make([]interface{}, 0, reflectIDs.Len())
+	keyValues := make([]interface{}, 0, reflectIDs.Len())
+	seen := make(map[interface{}]struct{}, reflectIDs.Len())
+	for i := 0; i < reflectIDs.Len(); i++ {
+		key := reflectIDs.Index(i)
+		for key.Kind() == reflect.Ptr || key.Kind() == reflect.Interface {
+			if key.IsNil() {
+				return nil, nil, fmt.Errorf("%w: nil id", ErrInvalidID)
+			}
+			key = key.Elem()
+		}
+
+		keyValue := primaryKeyValue(primaryField, key)
+		if _, ok := seen[comparableKey(keyValue)]; ok {
+			continue
+		}
+
+		seen[comparableKey(keyValue)] = struct{}{}
+		keys = append(keys, key.Interface())
+		keyValues = append(keyValues, keyValue)
+	}
+
+	return keys, keyValues, nil
+}
+
+// primaryKeyValue id converted to the go type of primary field if they are of the same kind,
+// e.g. int to uint or string to named string type, so that ids compare equal to scanned primary keys
+func primaryKeyValue(primaryField *schema.Field, id reflect.Value) interface{} {
+	fieldType := primaryField.IndirectFieldType
+	if id.Type() == fieldType || !id.Type().ConvertibleTo(fieldType) {
+		return id.Interface()
+	}
+
+	idKind, fieldKind := keyKind(id.Type()), keyKind(fieldType)
+	if idKind == reflect.Invalid || idKind != fieldKind {
+		return id.Interface()
+	}
+
+	return id.Convert(fieldType).Interface()
+}
+
+// keyKind kind family of primary key type, integers and bytes are grouped
+func keyKind(keyType reflect.Type) reflect.Kind {
+	switch keyType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.Int64
+	case reflect.Slice:
+		if keyType.Elem().Kind() == reflect.Uint8 {
+			return reflect.Slice
+		}
+		return reflect.Invalid
+	default:
+		return keyType.Kind()
+	}
+}
+
+// comparableKey map key of primary key value, bytes are compared as string
+// and uncomparable values by their printed form
+func comparableKey(key interface{}) interface{} {
+	reflectKey := reflect.ValueOf(key)
+	for reflectKey.Kind() == reflect.Ptr && !reflectKey.IsNil() {
+		reflectKey = reflectKey.Elem()
+	}
+
+	switch {
+	case !reflectKey.IsValid():
+		return nil
+	case reflectKey.Kind() == reflect.Slice && reflectKey.Type().Elem().Kind() == reflect.Uint8:
+		return string(reflectKey.Bytes())
+	case reflectKey.Kind() == reflect.String:
+		return reflectKey.String()
+	case !reflectKey.Type().Comparable():
+		return fmt.Sprint(key)
+	default:
+		return reflectKey.Interface()
+	}
+}
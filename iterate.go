@@ -0,0 +1,179 @@
+package dbo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm"
+)
+
+// Iterate scan records matching condition one by one without loading the whole result, value is a pointer to model.
+// fn is called with a new pointer to model for each row, iteration stops on the first error of fn or when ctx is done.
+// The connection is busy reading rows until iteration ends, fn must not query through the same transaction,
+// which fails on MySQL, e.g. "commands out of sync", use another db context or collect rows and query afterwards.
+// Associations are not preloaded, conditions with preloads of PreloadConditions are rejected
+func (s BaseDA) Iterate(ctx context.Context, condition Conditions, value interface{}, fn func(row interface{}) error) error {
+	db, err := s.getReadDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.IterateTx(ctx, db, condition, value, fn)
+}
+
+// IterateTx scan records matching condition one by one with db context, fn must not query through db, see Iterate
+func (s BaseDA) IterateTx(ctx context.Context, db *DBContext, condition Conditions, value interface{}, fn func(row interface{}) error) error {
+	db.ResetCondition().applyScope(ctx)
+
+	if preloadConditions, ok := condition.(PreloadConditions); ok && len(preloadConditions.GetPreloads()) > 0 {
+		err := fmt.Errorf("%w: iterate doesn't preload %v", ErrUnsupportedCondition, preloadConditions.GetPreloads())
+		log.Warn(ctx, "iterate failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition))
+		return err
+	}
+
+	lock := conditionLock(condition)
+	if err := db.applyLock(lock); err != nil {
+		log.Warn(ctx, "iterate with lock failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("lock", lock))
+		return err
+	}
+
+	scanner := db.Session(&gorm.Session{NewDB: true})
+	db.applyJoins(condition)
+	db.applyConditions(condition)
+	db.applyGroup(condition)
+	db.applySelect(condition)
+	orderBy, pager, err := db.applyOrderAndPager(condition, value)
+	if err != nil {
+		log.Warn(ctx, "iterate failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.String("orderBy", orderBy))
+		return err
+	}
+
+	start := time.Now()
+	rows, err := db.Model(value).Rows()
+	if err != nil {
+		log.Warn(ctx, "iterate failed",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("pager", pager),
+			log.String("orderBy", orderBy),
+			log.Duration("duration", time.Since(start)))
+		return err
+	}
+
+	total, err := iterateRows(ctx, scanner, rows, value, fn)
+	if err != nil {
+		log.Warn(ctx, "iterate stopped",
+			log.Err(err),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("condition", condition),
+			log.Any("pager", pager),
+			log.String("orderBy", orderBy),
+			log.Any("total", total),
+			log.Duration("duration", time.Since(start)))
+		return err
+	}
+
+	log.Debug(ctx, "iterate successfully",
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("condition", condition),
+		log.Any("pager", pager),
+		log.String("orderBy", orderBy),
+		log.Any("total", total),
+		log.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// QueryRawSQLIter scan result of raw sql one by one without loading the whole result, value is a pointer to row type.
+// fn is called with a new pointer to row type for each row, iteration stops on the first error of fn or when ctx is done.
+// fn must not query through the same transaction while rows are read, see Iterate
+func (s BaseDA) QueryRawSQLIter(ctx context.Context, value interface{}, fn func(row interface{}) error, sql string, parameters ...interface{}) error {
+	db, err := s.getReadDB(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.QueryRawSQLIterTx(ctx, db, value, fn, sql, parameters...)
+}
+
+// QueryRawSQLIterTx scan result of raw sql one by one with db context, fn must not query through db, see QueryRawSQLIter
+func (s BaseDA) QueryRawSQLIterTx(ctx context.Context, db *DBContext, value interface{}, fn func(row interface{}) error, sql string, parameters ...interface{}) error {
+	db.ResetCondition()
+	scanner := db.Session(&gorm.Session{NewDB: true})
+
+	start := time.Now()
+	rows, err := db.Raw(sql, parameters...).Rows()
+	if err != nil {
+		log.Warn(ctx, "query raw sql iter failed",
+			log.Err(err),
+			log.String("sql", sql),
+			log.Any("parameters", parameters),
+			log.Duration("duration", time.Since(start)))
+		return err
+	}
+
+	total, err := iterateRows(ctx, scanner, rows, value, fn)
+	if err != nil {
+		log.Warn(ctx, "query raw sql iter stopped",
+			log.Err(err),
+			log.String("sql", sql),
+			log.Any("parameters", parameters),
+			log.Any("total", total),
+			log.Duration("duration", time.Since(start)))
+		return err
+	}
+
+	log.Debug(ctx, "query raw sql iter successfully",
+		log.String("sql", sql),
+		log.Any("parameters", parameters),
+		log.Any("total", total),
+		log.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// iterateRows scan rows into new value of the type value points to and call fn for each row,
+// rows are closed on return, return number of rows passed to fn
+func iterateRows(ctx context.Context, scanner *gorm.DB, rows *sql.Rows, value interface{}, fn func(row interface{}) error) (int64, error) {
+	defer rows.Close()
+
+	valueType := reflect.TypeOf(value)
+	if valueType == nil || valueType.Kind() != reflect.Ptr {
+		return 0, fmt.Errorf("iterate requires pointer value, got %T", value)
+	}
+
+	var total int64
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		row := reflect.New(valueType.Elem()).Interface()
+		if err := scanner.ScanRows(rows, row); err != nil {
+			return total, err
+		}
+
+		if err := fn(row); err != nil {
+			return total, err
+		}
+		total++
+	}
+
+	return total, rows.Err()
+}
@@ -0,0 +1,106 @@
+package dbo
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockMode row lock mode of select
+type LockMode int
+
+const (
+	// NoLock plain select without row lock
+	NoLock LockMode = iota
+	// LockForUpdate select ... for update, exclusive row lock
+	LockForUpdate
+	// LockForShare select ... for share, shared row lock
+	LockForShare
+)
+
+// Lock row lock of select, only allowed in transaction.
+// NoWait and SkipLocked are exclusive, NoWait takes precedence if both are set.
+// SQLite has no row lock and ignores it
+type Lock struct {
+	Mode LockMode
+	// NoWait fail immediately instead of waiting if rows are locked by other transaction
+	NoWait bool
+	// SkipLocked skip rows locked by other transaction, e.g. for job queue consumers
+	SkipLocked bool
+}
+
+// Locker optional Conditions extension, lock rows selected by QueryTx/PageTx.
+// PageTx locks all rows matching condition by counting them in a locked subquery, so that total agrees with locked page
+type Locker interface {
+	GetLock() Lock
+}
+
+// LockClauser optional Dialect extension, row lock clause of select instead of FOR UPDATE/FOR SHARE
+type LockClauser interface {
+	LockClause(lock Lock) clause.Expression
+}
+
+// ForUpdate exclusive row lock
+func ForUpdate() Lock {
+	return Lock{Mode: LockForUpdate}
+}
+
+// ForShare shared row lock
+func ForShare() Lock {
+	return Lock{Mode: LockForShare}
+}
+
+// Enable whether lock is required
+func (s Lock) Enable() bool {
+	return s.Mode != NoLock
+}
+
+func (s Lock) clause() clause.Locking {
+	locking := clause.Locking{Strength: "UPDATE"}
+	if s.Mode == LockForShare {
+		locking.Strength = "SHARE"
+	}
+
+	switch {
+	case s.NoWait:
+		locking.Options = "NOWAIT"
+	case s.SkipLocked:
+		locking.Options = "SKIP LOCKED"
+	}
+
+	return locking
+}
+
+// conditionLock lock of condition, no lock unless condition implements Locker
+func conditionLock(condition Conditions) Lock {
+	locker, ok := condition.(Locker)
+	if !ok {
+		return Lock{}
+	}
+
+	return locker.GetLock()
+}
+
+// inTransaction whether db is in transaction
+func (s *DBContext) inTransaction() bool {
+	_, ok := s.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// applyLock apply row lock to query, return ErrLockOutsideTransaction if db is not in transaction
+func (s *DBContext) applyLock(lock Lock) error {
+	if !lock.Enable() {
+		return nil
+	}
+
+	if !s.inTransaction() {
+		return ErrLockOutsideTransaction
+	}
+
+	var expression clause.Expression = lock.clause()
+	if clauser, ok := s.Dialect().(LockClauser); ok {
+		expression = clauser.LockClause(lock)
+	}
+
+	s.DB = s.DB.Clauses(expression)
+	return nil
+}
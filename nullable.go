@@ -18,7 +18,7 @@ func (s NullStrings) ToInterfaceSlice() []interface{} {
 	return slice
 }
 
-// SQLPlaceHolder generate sql place holder
+// SQLPlaceHolder generate sql place holder, ? is bound by gorm on every database
 func (s NullStrings) SQLPlaceHolder() string {
 	if len(s.Strings) == 0 && s.Valid {
 		return "null"
@@ -43,7 +43,7 @@ func (s NullInts) ToInterfaceSlice() []interface{} {
 	return slice
 }
 
-// SQLPlaceHolder generate sql place holder
+// SQLPlaceHolder generate sql place holder, ? is bound by gorm on every database
 func (s NullInts) SQLPlaceHolder() string {
 	if len(s.Ints) == 0 && s.Valid {
 		return "null"
@@ -0,0 +1,125 @@
+package dbo
+
+import (
+	"strings"
+)
+
+// Predicate node of condition tree, see PredicateConditions
+type Predicate interface {
+	// Build render predicate to sql and parameters, empty sql if predicate has no condition
+	Build() (string, []interface{})
+}
+
+// PredicateConditions optional Conditions extension, condition tree rendered with proper grouping.
+// Predicate is combined with flat conditions of GetConditions by and
+type PredicateConditions interface {
+	GetPredicate() Predicate
+}
+
+type exprPredicate struct {
+	sql        string
+	parameters []interface{}
+}
+
+// Expr leaf predicate of raw sql with parameters
+func Expr(sql string, parameters ...interface{}) Predicate {
+	return exprPredicate{sql: sql, parameters: parameters}
+}
+
+func (p exprPredicate) Build() (string, []interface{}) {
+	if p.sql == "" {
+		return "", nil
+	}
+
+	return "(" + p.sql + ")", p.parameters
+}
+
+type groupPredicate struct {
+	separator  string
+	predicates []Predicate
+}
+
+// And all of predicates match, empty predicates are ignored
+func And(predicates ...Predicate) Predicate {
+	return groupPredicate{separator: " and ", predicates: predicates}
+}
+
+// Or any of predicates matches, empty predicates are ignored
+func Or(predicates ...Predicate) Predicate {
+	return groupPredicate{separator: " or ", predicates: predicates}
+}
+
+func (p groupPredicate) Build() (string, []interface{}) {
+	sqls := make([]string, 0, len(p.predicates))
+	var parameters []interface{}
+	for _, predicate := range p.predicates {
+		if predicate == nil {
+			continue
+		}
+
+		sql, predicateParameters := predicate.Build()
+		if sql == "" {
+			continue
+		}
+
+		sqls = append(sqls, sql)
+		parameters = append(parameters, predicateParameters...)
+	}
+
+	switch len(sqls) {
+	case 0:
+		return "", nil
+	case 1:
+		return sqls[0], parameters
+	default:
+		return "(" + strings.Join(sqls, p.separator) + ")", parameters
+	}
+}
+
+type notPredicate struct {
+	predicate Predicate
+}
+
+// Not predicate doesn't match, empty predicate is ignored
+func Not(predicate Predicate) Predicate {
+	return notPredicate{predicate: predicate}
+}
+
+func (p notPredicate) Build() (string, []interface{}) {
+	if p.predicate == nil {
+		return "", nil
+	}
+
+	sql, parameters := p.predicate.Build()
+	if sql == "" {
+		return "", nil
+	}
+
+	return "(not " + sql + ")", parameters
+}
+
+// whereClause where clause of condition, each fragment of GetConditions is grouped and joined by and,
+// then combined with predicate if condition implements PredicateConditions
+func whereClause(condition Conditions) (string, []interface{}) {
+	wheres, parameters := condition.GetConditions()
+
+	var sql string
+	if len(wheres) > 0 {
+		sql = "(" + strings.Join(wheres, ") and (") + ")"
+	}
+
+	predicateConditions, ok := condition.(PredicateConditions)
+	if !ok || predicateConditions.GetPredicate() == nil {
+		return sql, parameters
+	}
+
+	predicateSQL, predicateParameters := predicateConditions.GetPredicate().Build()
+	switch {
+	case predicateSQL == "":
+		return sql, parameters
+	case sql == "":
+		return predicateSQL, predicateParameters
+	default:
+		return sql + " and " + predicateSQL, append(parameters[:len(parameters):len(parameters)], predicateParameters...)
+	}
+}
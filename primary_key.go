@@ -0,0 +1,130 @@
+package dbo
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// primaryFields primary key fields of model
+func (s *DBContext) primaryFields(value interface{}) ([]*schema.Field, error) {
+	stmt := &gorm.Statement{DB: s.DB}
+	err := stmt.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("%w: %s has no primary key", ErrInvalidID, stmt.Schema.Table)
+	}
+
+	return stmt.Schema.PrimaryFields, nil
+}
+
+// applyPrimaryKey apply where condition of primary key(s) of model.
+// id is the key value for single primary key, a map keyed by field or column name,
+// or a struct with fields named as primary key fields for composite primary keys.
+// return ErrInvalidID if id doesn't match primary keys of model
+func (s *DBContext) applyPrimaryKey(value interface{}, id interface{}) error {
+	primaryFields, err := s.primaryFields(value)
+	if err != nil {
+		return err
+	}
+
+	keys, err := primaryKeyValues(primaryFields, id)
+	if err != nil {
+		return err
+	}
+
+	exprs := make([]clause.Expression, 0, len(primaryFields))
+	for i, field := range primaryFields {
+		exprs = append(exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: keys[i]})
+	}
+
+	s.DB = s.DB.Clauses(clause.Where{Exprs: exprs})
+	return nil
+}
+
+// primaryKeyValues values of primary keys in id, in the order of primaryFields
+func primaryKeyValues(primaryFields []*schema.Field, id interface{}) ([]interface{}, error) {
+	if id == nil {
+		return nil, fmt.Errorf("%w: nil id", ErrInvalidID)
+	}
+
+	reflectValue := reflect.ValueOf(id)
+	for reflectValue.Kind() == reflect.Ptr {
+		if reflectValue.IsNil() {
+			return nil, fmt.Errorf("%w: nil id", ErrInvalidID)
+		}
+		reflectValue = reflectValue.Elem()
+	}
+
+	switch {
+	case reflectValue.Kind() == reflect.Map && reflectValue.Type().Key().Kind() == reflect.String:
+		return mapKeyValues(primaryFields, reflectValue)
+	case reflectValue.Kind() == reflect.Struct && !isScalarStruct(reflectValue.Type()):
+		return structKeyValues(primaryFields, reflectValue)
+	case len(primaryFields) > 1:
+		return nil, fmt.Errorf("%w: expect map or struct of %d primary keys, got %T", ErrInvalidID, len(primaryFields), id)
+	default:
+		return []interface{}{reflectValue.Interface()}, nil
+	}
+}
+
+func mapKeyValues(primaryFields []*schema.Field, id reflect.Value) ([]interface{}, error) {
+	if id.Len() != len(primaryFields) {
+		return nil, fmt.Errorf("%w: expect %d primary keys, got %d", ErrInvalidID, len(primaryFields), id.Len())
+	}
+
+	keys := make([]interface{}, 0, len(primaryFields))
+	for _, field := range primaryFields {
+		key := id.MapIndex(reflect.ValueOf(field.DBName).Convert(id.Type().Key()))
+		if !key.IsValid() {
+			key = id.MapIndex(reflect.ValueOf(field.Name).Convert(id.Type().Key()))
+		}
+		if !key.IsValid() {
+			return nil, fmt.Errorf("%w: missing primary key %s", ErrInvalidID, field.DBName)
+		}
+
+		keys = append(keys, key.Interface())
+	}
+
+	return keys, nil
+}
+
+func structKeyValues(primaryFields []*schema.Field, id reflect.Value) ([]interface{}, error) {
+	keys := make([]interface{}, 0, len(primaryFields))
+	for _, field := range primaryFields {
+		if id.Type() == field.Schema.ModelType {
+			key, zero := field.ValueOf(id)
+			if zero {
+				return nil, fmt.Errorf("%w: zero primary key %s", ErrInvalidID, field.DBName)
+			}
+
+			keys = append(keys, key)
+			continue
+		}
+
+		key := id.FieldByName(field.Name)
+		if !key.IsValid() {
+			return nil, fmt.Errorf("%w: missing primary key %s in %s", ErrInvalidID, field.Name, id.Type())
+		}
+
+		keys = append(keys, key.Interface())
+	}
+
+	return keys, nil
+}
+
+// isScalarStruct whether struct type is a single column value, e.g. time.Time or sql.NullString
+func isScalarStruct(structType reflect.Type) bool {
+	return structType == reflect.TypeOf(time.Time{}) ||
+		structType.Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem()) ||
+		reflect.PtrTo(structType).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem())
+}
@@ -0,0 +1,76 @@
+package dbo
+
+import (
+	"context"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// ReplicaPolicy policy to select replica for read only queries
+type ReplicaPolicy string
+
+const (
+	// RoundRobin select replicas in turn
+	RoundRobin ReplicaPolicy = "round_robin"
+	// LeastConn select replica with the fewest in-use connections
+	LeastConn ReplicaPolicy = "least_conn"
+)
+
+func (p ReplicaPolicy) String() string {
+	return string(p)
+}
+
+type replicaSet struct {
+	dbs     []*gorm.DB
+	policy  ReplicaPolicy
+	counter uint64
+}
+
+func newReplicaSet(dbs []*gorm.DB, policy ReplicaPolicy) *replicaSet {
+	if len(dbs) == 0 {
+		return nil
+	}
+
+	return &replicaSet{dbs: dbs, policy: policy}
+}
+
+func (s *replicaSet) next() *gorm.DB {
+	if s.policy == LeastConn {
+		return s.leastConn()
+	}
+
+	index := atomic.AddUint64(&s.counter, 1)
+	return s.dbs[index%uint64(len(s.dbs))]
+}
+
+func (s *replicaSet) leastConn() *gorm.DB {
+	selected := s.dbs[0]
+	minInUse := -1
+	for _, db := range s.dbs {
+		sqlDB, err := db.DB()
+		if err != nil {
+			continue
+		}
+
+		inUse := sqlDB.Stats().InUse
+		if minInUse < 0 || inUse < minInUse {
+			selected = db
+			minInUse = inUse
+		}
+	}
+
+	return selected
+}
+
+type forcePrimaryKey struct{}
+
+// ForcePrimary mark ctx to read from primary database, for read-your-writes paths
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+func isForcePrimary(ctx context.Context) bool {
+	forcePrimary, _ := ctx.Value(forcePrimaryKey{}).(bool)
+	return forcePrimary
+}
@@ -0,0 +1,270 @@
+package dbo
+
+import "context"
+
+// BaseRepo typed data access of model T, delegates to BaseDA for logging and error mapping
+type BaseRepo[T any] struct {
+	// DBName name of registered dbo instance, empty for the default one
+	DBName string
+}
+
+func (s BaseRepo[T]) da() BaseDA {
+	return BaseDA{DBName: s.DBName}
+}
+
+func (s BaseRepo[T]) Insert(ctx context.Context, value *T) error {
+	_, err := s.da().Insert(ctx, value)
+	return err
+}
+
+func (s BaseRepo[T]) InsertTx(ctx context.Context, db *DBContext, value *T) error {
+	_, err := s.da().InsertTx(ctx, db, value)
+	return err
+}
+
+// InsertInBatches insert records in batch, generated primary keys are written back to values
+func (s BaseRepo[T]) InsertInBatches(ctx context.Context, values []T, batchSize int) error {
+	_, err := s.da().InsertInBatches(ctx, values, batchSize)
+	return err
+}
+
+// InsertInBatchesTx insert records in batch with db context, generated primary keys are written back to values
+func (s BaseRepo[T]) InsertInBatchesTx(ctx context.Context, db *DBContext, values []T, batchSize int) error {
+	_, err := s.da().InsertInBatchesTx(ctx, db, values, batchSize)
+	return err
+}
+
+func (s BaseRepo[T]) Update(ctx context.Context, value *T) (int64, error) {
+	return s.da().Update(ctx, value)
+}
+
+func (s BaseRepo[T]) UpdateTx(ctx context.Context, db *DBContext, value *T) (int64, error) {
+	return s.da().UpdateTx(ctx, db, value)
+}
+
+func (s BaseRepo[T]) Save(ctx context.Context, value *T) error {
+	return s.da().Save(ctx, value)
+}
+
+func (s BaseRepo[T]) SaveTx(ctx context.Context, db *DBContext, value *T) error {
+	return s.da().SaveTx(ctx, db, value)
+}
+
+func (s BaseRepo[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	value := new(T)
+	err := s.da().Get(ctx, id, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (s BaseRepo[T]) GetTx(ctx context.Context, db *DBContext, id interface{}) (*T, error) {
+	value := new(T)
+	err := s.da().GetTx(ctx, db, id, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// GetMany get records by ids, return ids not found, see BaseDA.GetMany
+func (s BaseRepo[T]) GetMany(ctx context.Context, ids interface{}, options ...GetManyOption) ([]T, []interface{}, error) {
+	var values []T
+	missing, err := s.da().GetMany(ctx, ids, &values, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return values, missing, nil
+}
+
+func (s BaseRepo[T]) GetManyTx(ctx context.Context, db *DBContext, ids interface{}, options ...GetManyOption) ([]T, []interface{}, error) {
+	var values []T
+	missing, err := s.da().GetManyTx(ctx, db, ids, &values, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return values, missing, nil
+}
+
+func (s BaseRepo[T]) GetWithLockTx(ctx context.Context, db *DBContext, id interface{}, lock Lock) (*T, error) {
+	value := new(T)
+	err := s.da().GetWithLockTx(ctx, db, id, value, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (s BaseRepo[T]) Query(ctx context.Context, condition Conditions) ([]T, error) {
+	var values []T
+	err := s.da().Query(ctx, condition, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s BaseRepo[T]) QueryTx(ctx context.Context, db *DBContext, condition Conditions) ([]T, error) {
+	var values []T
+	err := s.da().QueryTx(ctx, db, condition, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s BaseRepo[T]) Count(ctx context.Context, condition Conditions) (int, error) {
+	return s.da().Count(ctx, condition, new(T))
+}
+
+func (s BaseRepo[T]) CountTx(ctx context.Context, db *DBContext, condition Conditions) (int, error) {
+	return s.da().CountTx(ctx, db, condition, new(T))
+}
+
+func (s BaseRepo[T]) Page(ctx context.Context, condition Conditions) ([]T, int, error) {
+	var values []T
+	total, err := s.da().Page(ctx, condition, &values)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return values, total, nil
+}
+
+func (s BaseRepo[T]) PageTx(ctx context.Context, db *DBContext, condition Conditions) ([]T, int, error) {
+	var values []T
+	total, err := s.da().PageTx(ctx, db, condition, &values)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return values, total, nil
+}
+
+func (s BaseRepo[T]) QueryRawSQL(ctx context.Context, sql string, parameters ...interface{}) ([]T, error) {
+	var values []T
+	err := s.da().QueryRawSQL(ctx, &values, sql, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s BaseRepo[T]) QueryRawSQLTx(ctx context.Context, db *DBContext, sql string, parameters ...interface{}) ([]T, error) {
+	var values []T
+	err := s.da().QueryRawSQLTx(ctx, db, &values, sql, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (s BaseRepo[T]) Delete(ctx context.Context, id interface{}) (int64, error) {
+	return s.da().Delete(ctx, id, new(T))
+}
+
+func (s BaseRepo[T]) DeleteTx(ctx context.Context, db *DBContext, id interface{}) (int64, error) {
+	return s.da().DeleteTx(ctx, db, id, new(T))
+}
+
+func (s BaseRepo[T]) DeleteByConditions(ctx context.Context, condition Conditions) (int64, error) {
+	return s.da().DeleteByConditions(ctx, condition, new(T))
+}
+
+func (s BaseRepo[T]) DeleteByConditionsTx(ctx context.Context, db *DBContext, condition Conditions) (int64, error) {
+	return s.da().DeleteByConditionsTx(ctx, db, condition, new(T))
+}
+
+func (s BaseRepo[T]) Upsert(ctx context.Context, value *T, options ...UpsertOption) (UpsertResult, error) {
+	return s.da().Upsert(ctx, value, options...)
+}
+
+func (s BaseRepo[T]) UpsertTx(ctx context.Context, db *DBContext, value *T, options ...UpsertOption) (UpsertResult, error) {
+	return s.da().UpsertTx(ctx, db, value, options...)
+}
+
+func (s BaseRepo[T]) UpsertInBatches(ctx context.Context, values []T, batchSize int, options ...UpsertOption) (UpsertResult, error) {
+	return s.da().UpsertInBatches(ctx, values, batchSize, options...)
+}
+
+func (s BaseRepo[T]) UpsertInBatchesTx(ctx context.Context, db *DBContext, values []T, batchSize int, options ...UpsertOption) (UpsertResult, error) {
+	return s.da().UpsertInBatchesTx(ctx, db, values, batchSize, options...)
+}
+
+func (s BaseRepo[T]) UpdateColumns(ctx context.Context, id interface{}, changes map[string]interface{}) (int64, error) {
+	return s.da().UpdateColumns(ctx, new(T), id, changes)
+}
+
+func (s BaseRepo[T]) UpdateColumnsTx(ctx context.Context, db *DBContext, id interface{}, changes map[string]interface{}) (int64, error) {
+	return s.da().UpdateColumnsTx(ctx, db, new(T), id, changes)
+}
+
+func (s BaseRepo[T]) UpdateWhere(ctx context.Context, condition Conditions, changes map[string]interface{}) (int64, error) {
+	return s.da().UpdateWhere(ctx, condition, new(T), changes)
+}
+
+func (s BaseRepo[T]) UpdateWhereTx(ctx context.Context, db *DBContext, condition Conditions, changes map[string]interface{}) (int64, error) {
+	return s.da().UpdateWhereTx(ctx, db, condition, new(T), changes)
+}
+
+// Iterate scan records matching condition one by one, fn must not query through the same transaction, see BaseDA.Iterate
+func (s BaseRepo[T]) Iterate(ctx context.Context, condition Conditions, fn func(row *T) error) error {
+	return s.da().Iterate(ctx, condition, new(T), func(row interface{}) error {
+		return fn(row.(*T))
+	})
+}
+
+func (s BaseRepo[T]) IterateTx(ctx context.Context, db *DBContext, condition Conditions, fn func(row *T) error) error {
+	return s.da().IterateTx(ctx, db, condition, new(T), func(row interface{}) error {
+		return fn(row.(*T))
+	})
+}
+
+// ProcessInBatches process records matching condition in batches ordered by primary key, see BaseDA.ProcessInBatches
+func (s BaseRepo[T]) ProcessInBatches(ctx context.Context, condition Conditions, batchSize int,
+	fn func(ctx context.Context, tx *DBContext, batch []T) error, options ...BatchOption) (BatchProgress, error) {
+	return s.da().ProcessInBatches(ctx, condition, new(T), batchSize, func(ctx context.Context, tx *DBContext, batch interface{}) error {
+		return fn(ctx, tx, *batch.(*[]T))
+	}, options...)
+}
+
+// PageByCursor query a page of records by cursor, see BaseDA.PageByCursor
+func (s BaseRepo[T]) PageByCursor(ctx context.Context, condition Conditions) ([]T, CursorPage, error) {
+	var values []T
+	cursorPage, err := s.da().PageByCursor(ctx, condition, &values)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+
+	return values, cursorPage, nil
+}
+
+func (s BaseRepo[T]) PageByCursorTx(ctx context.Context, db *DBContext, condition Conditions) ([]T, CursorPage, error) {
+	var values []T
+	cursorPage, err := s.da().PageByCursorTx(ctx, db, condition, &values)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+
+	return values, cursorPage, nil
+}
+
+// Aggregate aggregate records matching condition into out, see BaseDA.Aggregate
+func (s BaseRepo[T]) Aggregate(ctx context.Context, condition Conditions, spec AggSpec, out interface{}) error {
+	return s.da().Aggregate(ctx, condition, new(T), spec, out)
+}
+
+// AggregateTx aggregate records matching condition into out with db context, see BaseDA.Aggregate
+func (s BaseRepo[T]) AggregateTx(ctx context.Context, db *DBContext, condition Conditions, spec AggSpec, out interface{}) error {
+	return s.da().AggregateTx(ctx, db, condition, new(T), spec, out)
+}
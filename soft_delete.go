@@ -0,0 +1,33 @@
+package dbo
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DeletedAt soft delete field, models with a DeletedAt field (column deleted_at) are soft deleted by
+// Delete/DeleteByConditions and soft deleted records are excluded from Get/Query/Count/Page
+type DeletedAt = gorm.DeletedAt
+
+type unscopedKey struct{}
+
+// Unscoped mark ctx to disable soft delete scope,
+// Get/Query/Count/Page include soft deleted records and Delete/DeleteByConditions delete records permanently
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+func isUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
+
+// applyScope disable soft delete scope if ctx is marked by Unscoped
+func (s *DBContext) applyScope(ctx context.Context) *DBContext {
+	if isUnscoped(ctx) {
+		s.DB = s.DB.Unscoped()
+	}
+
+	return s
+}
@@ -0,0 +1,183 @@
+package dbo
+
+import (
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sort structured order by, sort keys are validated before applied so it's safe to parse from user input
+type Sort []SortKey
+
+// SortConditions optional Conditions extension, structured order by takes precedence over GetOrderBy.
+// Sort columns are validated against fields of model unless condition implements SortColumnsAllower
+type SortConditions interface {
+	GetSort() Sort
+}
+
+// SortColumnsAllower optional SortConditions extension, columns allowed to sort by instead of fields of model,
+// e.g. columns of joined tables
+type SortColumnsAllower interface {
+	AllowedSortColumns() []string
+}
+
+// SortError invalid sort column or direction, wraps ErrInvalidSort
+type SortError struct {
+	Column string
+	Reason string
+}
+
+func (e *SortError) Error() string {
+	return ErrInvalidSort.Error() + ": " + e.Reason + " " + e.Column
+}
+
+func (e *SortError) Unwrap() error {
+	return ErrInvalidSort
+}
+
+var sortColumnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ParseSort parse comma separated sort keys, each key is "column", "-column" for descending,
+// or the order by form "column asc" / "column desc", e.g. "-created_at,name" or "created_at desc, name".
+// A key with both prefix and direction, e.g. "-id desc", is malformed
+func ParseSort(s string) (Sort, error) {
+	var sort Sort
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+
+		key := SortKey{Column: fields[0]}
+		prefixed := strings.HasPrefix(key.Column, "-") || strings.HasPrefix(key.Column, "+")
+		if prefixed {
+			key.Column, key.Desc = key.Column[1:], key.Column[0] == '-'
+		}
+
+		if len(fields) > 2 || (prefixed && len(fields) == 2) {
+			return nil, &SortError{Column: strings.TrimSpace(part), Reason: "malformed sort key"}
+		}
+
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				key.Desc = true
+			default:
+				return nil, &SortError{Column: strings.TrimSpace(part), Reason: "invalid sort direction"}
+			}
+		}
+
+		if !sortColumnPattern.MatchString(key.Column) {
+			return nil, &SortError{Column: key.Column, Reason: "invalid sort column"}
+		}
+
+		sort = append(sort, key)
+	}
+
+	return sort, nil
+}
+
+// String order by form of sort, e.g. "created_at desc, name"
+func (s Sort) String() string {
+	keys := make([]string, 0, len(s))
+	for _, key := range s {
+		if key.Desc {
+			keys = append(keys, key.Column+" desc")
+		} else {
+			keys = append(keys, key.Column)
+		}
+	}
+
+	return strings.Join(keys, ", ")
+}
+
+// Validate check sort columns are in allowed columns
+func (s Sort) Validate(allowed ...string) error {
+	allowedColumns := make(map[string]bool, len(allowed))
+	for _, column := range allowed {
+		allowedColumns[column] = true
+	}
+
+	for _, key := range s {
+		if !allowedColumns[key.Column] {
+			return &SortError{Column: key.Column, Reason: "sort column not allowed"}
+		}
+	}
+
+	return nil
+}
+
+// orderByClause order by clause of sort, columns are validated against allowed columns if any, otherwise fields of model.
+// Qualified columns of other tables, e.g. "class.name", are only allowed if joined, and unvalidated except as identifiers.
+// Result column aliases, e.g. of aggregates, are allowed as well
+func (s *DBContext) orderByClause(sort Sort, allowed []string, joined bool, aliases []string, value interface{}) (clause.OrderBy, error) {
+	orderBy := clause.OrderBy{Columns: make([]clause.OrderByColumn, 0, len(sort))}
+	for _, key := range sort {
+		if !sortColumnPattern.MatchString(key.Column) {
+			return orderBy, &SortError{Column: key.Column, Reason: "invalid sort column"}
+		}
+	}
+
+	if allowed != nil {
+		if err := sort.Validate(append(allowed[:len(allowed):len(allowed)], aliases...)...); err != nil {
+			return orderBy, err
+		}
+
+		for _, key := range sort {
+			orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: sortColumn(key.Column), Desc: key.Desc})
+		}
+
+		return orderBy, nil
+	}
+
+	stmt := &gorm.Statement{DB: s.DB}
+	if err := stmt.Parse(value); err != nil {
+		return orderBy, err
+	}
+
+	isAlias := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		isAlias[alias] = true
+	}
+
+	for _, key := range sort {
+		if isAlias[key.Column] {
+			orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Name: key.Column}, Desc: key.Desc})
+			continue
+		}
+
+		column := sortColumn(key.Column)
+		if column.Table != "" && column.Table != stmt.Schema.Table {
+			if !joined {
+				return orderBy, &SortError{Column: key.Column, Reason: "unknown sort column"}
+			}
+
+			orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: column, Desc: key.Desc})
+			continue
+		}
+
+		field := stmt.Schema.LookUpField(column.Name)
+		if field == nil || field.DBName == "" {
+			return orderBy, &SortError{Column: key.Column, Reason: "unknown sort column"}
+		}
+
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+			Desc:   key.Desc,
+		})
+	}
+
+	return orderBy, nil
+}
+
+// sortColumn column of sort key, qualified column is split into table and column to be quoted separately
+func sortColumn(column string) clause.Column {
+	if table, name, ok := strings.Cut(column, "."); ok {
+		return clause.Column{Table: table, Name: name}
+	}
+
+	return clause.Column{Name: column}
+}
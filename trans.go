@@ -3,71 +3,143 @@ package dbo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
 
 	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm"
 )
 
 // GetTrans begin a transaction
 func GetTrans(ctx context.Context, fn func(ctx context.Context, tx *DBContext) error) error {
-	log.Debug(ctx, "begin transaction")
+	return GetTransNamed(ctx, DefaultName, fn)
+}
 
-	dbo, err := GetGlobal()
+// GetTransNamed begin a transaction of named dbo instance
+func GetTransNamed(ctx context.Context, name string, fn func(ctx context.Context, tx *DBContext) error) error {
+	dbo, err := GetNamed(name)
 	if err != nil {
 		return err
 	}
 
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, dbo.config.TransactionTimeout)
-	defer cancel()
+	return dbo.GetTrans(ctx, fn)
+}
 
-	db, err := GetDB(ctxWithTimeout)
+// GetTrans begin a transaction, create a savepoint instead if ctx is inside a transaction of s
+func (s DBO) GetTrans(ctx context.Context, fn func(ctx context.Context, tx *DBContext) error) error {
+	return s.GetTransWithOptions(ctx, fn)
+}
+
+// GetTransWithOptions begin a transaction with options
+func GetTransWithOptions(ctx context.Context, fn func(ctx context.Context, tx *DBContext) error, options ...TransOption) error {
+	dbo, err := GetGlobal()
 	if err != nil {
 		return err
 	}
 
-	//db.DB = db.BeginTx(ctxWithTimeout, &sql.TxOptions{})
-	db.DB = db.Begin(&sql.TxOptions{})
-	funcDone := make(chan error)
-	go func() {
-		defer func() {
-			if err1 := recover(); err1 != nil {
-				log.Warn(ctxWithTimeout, "transaction panic", log.Any("recover error", err1))
-				funcDone <- fmt.Errorf("transaction panic: %+v", err1)
-			}
-		}()
+	return dbo.GetTransWithOptions(ctx, fn, options...)
+}
 
-		// call func
-		funcDone <- fn(ctxWithTimeout, db)
-	}()
+// GetTransWithOptions begin a transaction with options, see GetTransResultWithOptions
+func (s DBO) GetTransWithOptions(ctx context.Context, fn func(ctx context.Context, tx *DBContext) error, options ...TransOption) error {
+	_, err := s.GetTransResultWithOptions(ctx, func(ctx context.Context, tx *DBContext) (interface{}, error) {
+		return nil, fn(ctx, tx)
+	}, options...)
 
-	select {
-	case err = <-funcDone:
-		log.Debug(ctxWithTimeout, "transaction fn done")
-	case <-ctxWithTimeout.Done():
-		// context deadline exceeded
-		err = ctxWithTimeout.Err()
-		log.Warn(ctxWithTimeout, "transaction context deadline exceeded", log.Err(err))
+	return err
+}
+
+// cancelQueryTimeout timeout of canceling running statement of timed out transaction
+const cancelQueryTimeout = 3 * time.Second
+
+// TransOption transaction option
+type TransOption func(*transOptions)
+
+type transOptions struct {
+	timeout        time.Duration
+	txOptions      sql.TxOptions
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retryable      func(err error) bool
+}
+
+func (o *transOptions) isRetryable(dialect Dialect, err error) bool {
+	if o.retryable != nil {
+		return o.retryable(err)
 	}
 
-	if err != nil {
-		err1 := db.Rollback().Error
-		if err1 != nil {
-			log.Warn(ctxWithTimeout, "rollback transaction failed", log.String("outer error", err.Error()), log.Err(err1))
-		} else {
-			log.Debug(ctxWithTimeout, "rollback transaction successfully")
+	if classified := dialect.ClassifyError(err); classified != nil {
+		err = classified
+	}
+
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrLockWaitTimeout) || errors.Is(err, ErrSerializationFailure)
+}
+
+// backoff jittered delay before next attempt
+func (o *transOptions) backoff(attempt int) time.Duration {
+	backoff := o.initialBackoff
+	for i := 1; i < attempt && backoff < o.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.maxBackoff {
+		backoff = o.maxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	// [backoff/2, backoff)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// WithTransTimeout set timeout of transaction, override Config.TransactionTimeout
+func WithTransTimeout(timeout time.Duration) TransOption {
+	return func(o *transOptions) {
+		if timeout > 0 {
+			o.timeout = timeout
 		}
-		return err
 	}
+}
 
-	err = db.Commit().Error
-	if err != nil {
-		log.Warn(ctxWithTimeout, "commit transaction failed", log.Err(err))
-		return err
+// WithTransIsolation set isolation level of transaction
+func WithTransIsolation(isolation sql.IsolationLevel) TransOption {
+	return func(o *transOptions) {
+		o.txOptions.Isolation = isolation
 	}
+}
 
-	log.Debug(ctxWithTimeout, "commit transaction successfully")
+// WithTransReadOnly begin a read only transaction
+func WithTransReadOnly() TransOption {
+	return func(o *transOptions) {
+		o.txOptions.ReadOnly = true
+	}
+}
+
+// WithTransRetry re-run the whole transaction up to maxAttempts times when it fails with retryable error,
+// e.g. deadlock or lock wait timeout, fn must be safe to re-run
+func WithTransRetry(maxAttempts int) TransOption {
+	return func(o *transOptions) {
+		o.maxAttempts = maxAttempts
+	}
+}
 
-	return nil
+// WithTransRetryBackoff set exponential backoff between retries, the delay is jittered and capped by maxBackoff
+func WithTransRetryBackoff(initialBackoff, maxBackoff time.Duration) TransOption {
+	return func(o *transOptions) {
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithTransRetryable set the hook to classify retryable errors, default to deadlock, lock wait timeout and serialization failure
+func WithTransRetryable(retryable func(err error) bool) TransOption {
+	return func(o *transOptions) {
+		o.retryable = retryable
+	}
 }
 
 type transactionResult struct {
@@ -75,26 +147,114 @@ type transactionResult struct {
 	Error  error
 }
 
+// transactionKey context key of active transaction, one per dbo instance
+type transactionKey struct {
+	db *gorm.DB
+}
+
+type transaction struct {
+	tx         *DBContext
+	savepoints int64
+}
+
 // GetTransResult begin a transaction, get result of callback
 func GetTransResult(ctx context.Context, fn func(ctx context.Context, tx *DBContext) (interface{}, error)) (interface{}, error) {
-	log.Debug(ctx, "begin transaction")
+	return GetTransResultNamed(ctx, DefaultName, fn)
+}
 
-	dbo, err := GetGlobal()
+// GetTransResultNamed begin a transaction of named dbo instance, get result of callback
+func GetTransResultNamed(ctx context.Context, name string, fn func(ctx context.Context, tx *DBContext) (interface{}, error)) (interface{}, error) {
+	dbo, err := GetNamed(name)
 	if err != nil {
 		return nil, err
 	}
 
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, dbo.config.TransactionTimeout)
-	defer cancel()
+	return dbo.GetTransResult(ctx, fn)
+}
+
+// GetTransResult begin a transaction, get result of callback
+func (s DBO) GetTransResult(ctx context.Context, fn func(ctx context.Context, tx *DBContext) (interface{}, error)) (interface{}, error) {
+	return s.GetTransResultWithOptions(ctx, fn)
+}
 
-	db, err := GetDB(ctxWithTimeout)
+// GetTransResultWithOptions begin a transaction with options, get result of callback
+func GetTransResultWithOptions(ctx context.Context, fn func(ctx context.Context, tx *DBContext) (interface{}, error), options ...TransOption) (interface{}, error) {
+	dbo, err := GetGlobal()
 	if err != nil {
 		return nil, err
 	}
 
-	db.DB = db.Begin(&sql.TxOptions{})
+	return dbo.GetTransResultWithOptions(ctx, fn, options...)
+}
+
+// GetTransResultWithOptions begin a transaction with options, get result of callback.
+// if ctx is inside a transaction of s, create a savepoint of the outer transaction instead,
+// failure of fn rolls back to the savepoint only, and the work is committed along with the outer transaction.
+// options only take effect on the outermost transaction
+func (s DBO) GetTransResultWithOptions(ctx context.Context, fn func(ctx context.Context, tx *DBContext) (interface{}, error), options ...TransOption) (interface{}, error) {
+	if outer, ok := ctx.Value(transactionKey{s.db}).(*transaction); ok {
+		return s.getSavepointResult(ctx, outer, fn)
+	}
+
+	transOptions := &transOptions{
+		timeout:        s.config.TransactionTimeout,
+		maxAttempts:    1,
+		initialBackoff: 10 * time.Millisecond,
+		maxBackoff:     500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(transOptions)
+	}
+
+	log.Debug(ctx, "begin transaction",
+		log.Duration("timeout", transOptions.timeout),
+		log.String("isolation", transOptions.txOptions.Isolation.String()),
+		log.Any("readOnly", transOptions.txOptions.ReadOnly))
+
+	// queries inside transaction always go to primary database
+	ctxWithTimeout, cancel := context.WithTimeout(ForcePrimary(ctx), transOptions.timeout)
+	defer cancel()
+
+	// all attempts share the timeout of transaction
+	for attempt := 1; ; attempt++ {
+		result, err := s.runTransaction(ctxWithTimeout, fn, transOptions)
+		if err == nil || attempt >= transOptions.maxAttempts || !transOptions.isRetryable(s.dialect, err) {
+			return result, err
+		}
 
-	funcDone := make(chan *transactionResult)
+		backoff := transOptions.backoff(attempt)
+		log.Warn(ctxWithTimeout, "retry transaction",
+			log.Err(err),
+			log.Any("attempt", attempt),
+			log.Any("maxAttempts", transOptions.maxAttempts),
+			log.Duration("backoff", backoff))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctxWithTimeout.Done():
+			timer.Stop()
+			log.Warn(ctxWithTimeout, "transaction context deadline exceeded before retry", log.Err(ctxWithTimeout.Err()))
+			return nil, err
+		}
+	}
+}
+
+// runTransaction run fn in a new transaction once
+func (s DBO) runTransaction(ctxWithTimeout context.Context, fn func(ctx context.Context, tx *DBContext) (interface{}, error), transOptions *transOptions) (interface{}, error) {
+	db := s.GetDB(ctxWithTimeout)
+
+	// gorm begins transaction by BeginTx with context of db session, i.e. ctxWithTimeout
+	db.DB = db.Begin(&transOptions.txOptions)
+	if db.Error != nil {
+		log.Warn(ctxWithTimeout, "begin transaction failed", log.Err(db.Error))
+		return nil, db.Error
+	}
+	ctxWithTimeout = context.WithValue(ctxWithTimeout, transactionKey{s.db}, &transaction{tx: db})
+	queryCanceler := s.newQueryCanceler(ctxWithTimeout, db)
+
+	// buffered, fn goroutine never blocks on sending result after timeout
+	funcDone := make(chan *transactionResult, 1)
 	go func() {
 		defer func() {
 			if err1 := recover(); err1 != nil {
@@ -113,9 +273,11 @@ func GetTransResult(ctx context.Context, fn func(ctx context.Context, tx *DBCont
 	case funcResult = <-funcDone:
 		log.Debug(ctxWithTimeout, "transaction fn done")
 	case <-ctxWithTimeout.Done():
-		// context deadline exceeded
+		// context deadline exceeded, statements of fn are canceled by ctxWithTimeout,
+		// fn exits as soon as it checks ctx or issues the next statement
 		funcResult = &transactionResult{Error: ctxWithTimeout.Err()}
 		log.Warn(ctxWithTimeout, "transaction context deadline exceeded", log.Err(ctxWithTimeout.Err()))
+		queryCanceler.cancel()
 	}
 
 	if funcResult.Error != nil {
@@ -133,7 +295,7 @@ func GetTransResult(ctx context.Context, fn func(ctx context.Context, tx *DBCont
 		return nil, funcResult.Error
 	}
 
-	err = db.Commit().Error
+	err := db.Commit().Error
 	if err != nil {
 		log.Warn(ctxWithTimeout, "commit transaction failed", log.Err(err))
 		return nil, err
@@ -143,3 +305,101 @@ func GetTransResult(ctx context.Context, fn func(ctx context.Context, tx *DBCont
 
 	return funcResult.Result, nil
 }
+
+// getSavepointResult run fn inside a savepoint of outer transaction
+func (s DBO) getSavepointResult(ctx context.Context, outer *transaction, fn func(ctx context.Context, tx *DBContext) (interface{}, error)) (result interface{}, err error) {
+	savepoint := fmt.Sprintf("dbo_sp_%d", atomic.AddInt64(&outer.savepoints, 1))
+	// copy of outer transaction, conditions of fn don't leak to the outer one
+	tx := *outer.tx
+	tx.ResetCondition()
+
+	err = tx.SavePoint(savepoint).Error
+	if err != nil {
+		log.Warn(ctx, "create savepoint failed", log.String("savepoint", savepoint), log.Err(err))
+		return nil, err
+	}
+
+	log.Debug(ctx, "create savepoint successfully", log.String("savepoint", savepoint))
+
+	defer func() {
+		if err1 := recover(); err1 != nil {
+			log.Warn(ctx, "savepoint panic", log.String("savepoint", savepoint), log.Any("recover error", err1))
+			result, err = nil, fmt.Errorf("transaction panic: %+v", err1)
+		}
+
+		if err != nil {
+			err1 := tx.ResetCondition().RollbackTo(savepoint).Error
+			if err1 != nil {
+				log.Warn(ctx, "rollback to savepoint failed",
+					log.String("savepoint", savepoint),
+					log.String("transaction error", err.Error()),
+					log.Err(err1))
+			} else {
+				log.Debug(ctx, "rollback to savepoint successfully", log.String("savepoint", savepoint), log.Err(err))
+			}
+			return
+		}
+
+		err = tx.ResetCondition().Exec("RELEASE SAVEPOINT " + savepoint).Error
+		if err != nil {
+			log.Warn(ctx, "release savepoint failed", log.String("savepoint", savepoint), log.Err(err))
+			result = nil
+			return
+		}
+
+		log.Debug(ctx, "release savepoint successfully", log.String("savepoint", savepoint))
+	}()
+
+	return fn(ctx, &tx)
+}
+
+// transactionQueryCanceler cancel running statement of transaction on server side
+type transactionQueryCanceler struct {
+	ctx          context.Context
+	db           *gorm.DB
+	canceler     QueryCanceler
+	connectionID int64
+}
+
+// newQueryCanceler get connection id of transaction if Config.CancelQueryOnTimeout is enabled and dialect supports it
+func (s DBO) newQueryCanceler(ctx context.Context, tx *DBContext) *transactionQueryCanceler {
+	if !s.config.CancelQueryOnTimeout {
+		return nil
+	}
+
+	canceler, ok := s.dialect.(QueryCanceler)
+	if !ok {
+		return nil
+	}
+
+	connectionID, err := canceler.ConnectionID(tx.DB)
+	if err != nil {
+		log.Warn(ctx, "get transaction connection id failed", log.Err(err))
+		return nil
+	}
+
+	return &transactionQueryCanceler{
+		ctx:          ctx,
+		db:           s.db,
+		canceler:     canceler,
+		connectionID: connectionID,
+	}
+}
+
+func (s *transactionQueryCanceler) cancel() {
+	if s == nil {
+		return
+	}
+
+	// ctx of transaction is done, cancel with a new one
+	ctx, cancel := context.WithTimeout(context.Background(), cancelQueryTimeout)
+	defer cancel()
+
+	err := s.canceler.CancelQuery(s.db.WithContext(ctx), s.connectionID)
+	if err != nil {
+		log.Warn(s.ctx, "cancel transaction query failed", log.Err(err), log.Any("connectionID", s.connectionID))
+		return
+	}
+
+	log.Debug(s.ctx, "cancel transaction query successfully", log.Any("connectionID", s.connectionID))
+}
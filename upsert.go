@@ -0,0 +1,360 @@
+package dbo
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/Klasmart-Engineering/common-log/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// UpsertOption upsert option
+type UpsertOption func(*upsertOptions)
+
+type upsertOptions struct {
+	conflictColumns []string
+	updateColumns   []string
+	doNothing       bool
+}
+
+// OnConflictColumns columns of the unique key to detect conflict on, default to primary keys.
+// MySQL detects conflict on any unique key and ignores it
+func OnConflictColumns(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.conflictColumns = columns
+	}
+}
+
+// OnConflictUpdate update columns of existing record on conflict, default to all non-key columns
+func OnConflictUpdate(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.updateColumns = columns
+		o.doNothing = false
+	}
+}
+
+// OnConflictDoNothing keep existing record on conflict
+func OnConflictDoNothing() UpsertOption {
+	return func(o *upsertOptions) {
+		o.updateColumns = nil
+		o.doNothing = true
+	}
+}
+
+// UpsertResult result of upsert.
+// Inserted and Updated are reported only when Counted is true, otherwise RowsAffected is the only result
+type UpsertResult struct {
+	RowsAffected int64
+	Inserted     int64
+	Updated      int64
+	// Counted whether inserted and updated records are told apart by database, see UpsertCounter and UpsertReturner
+	Counted bool
+}
+
+// UpsertCounter optional Dialect extension, split rows affected by upsert into inserted and updated records,
+// return false if the split can't be derived exactly from rows affected
+type UpsertCounter interface {
+	CountUpsert(rows int64, rowsAffected int64) (inserted int64, updated int64, exact bool)
+}
+
+// UpsertReturner optional Dialect extension, tell inserted records from updated ones by RETURNING of upsert
+type UpsertReturner interface {
+	// UpsertInsertedExpr sql expression returned for each upserted row, true if the row is inserted
+	UpsertInsertedExpr() string
+}
+
+// Upsert insert record(s), update or keep the existing one on conflict
+func (s BaseDA) Upsert(ctx context.Context, value interface{}, options ...UpsertOption) (UpsertResult, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return UpsertResult{}, err
+	}
+
+	return s.UpsertTx(ctx, db, value, options...)
+}
+
+// UpsertTx insert record(s) with db context, update or keep the existing one on conflict
+func (s BaseDA) UpsertTx(ctx context.Context, db *DBContext, value interface{}, options ...UpsertOption) (UpsertResult, error) {
+	return s.upsert(ctx, db, value, 0, options...)
+}
+
+// UpsertInBatches insert records in batch, update or keep the existing ones on conflict
+func (s BaseDA) UpsertInBatches(ctx context.Context, value interface{}, batchSize int, options ...UpsertOption) (UpsertResult, error) {
+	db, err := s.getDB(ctx)
+	if err != nil {
+		return UpsertResult{}, err
+	}
+
+	return s.UpsertInBatchesTx(ctx, db, value, batchSize, options...)
+}
+
+// UpsertInBatchesTx insert records in batch with db context, update or keep the existing ones on conflict
+func (s BaseDA) UpsertInBatchesTx(ctx context.Context, db *DBContext, value interface{}, batchSize int, options ...UpsertOption) (UpsertResult, error) {
+	return s.upsert(ctx, db, value, batchSize, options...)
+}
+
+func (s BaseDA) upsert(ctx context.Context, db *DBContext, value interface{}, batchSize int, options ...UpsertOption) (UpsertResult, error) {
+	upsertOptions := &upsertOptions{}
+	for _, option := range options {
+		option(upsertOptions)
+	}
+
+	start := time.Now()
+	db.ResetCondition()
+	db.initVersions(value)
+	onConflict := upsertOptions.onConflict(db, value)
+	newDB := db.Clauses(onConflict)
+	var count *upsertCount
+	if _, ok := db.Dialect().(UpsertReturner); ok {
+		count = &upsertCount{}
+		newDB = newDB.Set(upsertCountKey, count)
+	}
+
+	if batchSize > 0 {
+		newDB = newDB.CreateInBatches(value, batchSize)
+	} else {
+		newDB = newDB.Create(value)
+	}
+	if newDB.Error != nil {
+		if constraintErr := db.constraintError(newDB.Error); constraintErr != nil {
+			log.Warn(ctx, "upsert violates constraint",
+				log.Err(newDB.Error),
+				log.String("violation", constraintErr.Error()),
+				log.String("tableName", db.GetTableName(value)),
+				log.Any("value", value),
+				log.Duration("duration", time.Since(start)))
+			return UpsertResult{}, constraintErr
+		}
+
+		log.Warn(ctx, "upsert failed",
+			log.Err(newDB.Error),
+			log.String("tableName", db.GetTableName(value)),
+			log.Any("value", value),
+			log.Duration("duration", time.Since(start)))
+		return UpsertResult{}, newDB.Error
+	}
+
+	result := UpsertResult{RowsAffected: newDB.RowsAffected}
+	counter, isCounter := db.Dialect().(UpsertCounter)
+	switch {
+	case count != nil:
+		result.RowsAffected = count.rows
+		result.Inserted, result.Updated, result.Counted = count.inserted, count.rows-count.inserted, true
+	case isCounter && upsertOptions.doNothing:
+		// records kept on conflict aren't affected
+		result.Inserted, result.Counted = newDB.RowsAffected, true
+	case isCounter:
+		result.Inserted, result.Updated, result.Counted = counter.CountUpsert(countRows(value), newDB.RowsAffected)
+	}
+
+	log.Debug(ctx, "upsert successfully",
+		log.String("tableName", db.GetTableName(value)),
+		log.Any("value", value),
+		log.Any("result", result),
+		log.Duration("duration", time.Since(start)))
+
+	return result, nil
+}
+
+func (o *upsertOptions) onConflict(db *DBContext, value interface{}) clause.OnConflict {
+	onConflict := clause.OnConflict{}
+	for _, column := range o.conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+
+	versionField := db.versionField(value)
+	switch {
+	case o.doNothing:
+		onConflict.DoNothing = true
+	case versionField != nil:
+		// increase version of existing record instead of overwriting it
+		updateColumns := o.updateColumns
+		if len(updateColumns) == 0 {
+			updateColumns = updatableColumns(versionField.Schema)
+		}
+
+		columns := make([]string, 0, len(updateColumns))
+		for _, column := range updateColumns {
+			if column != versionField.DBName && column != versionField.Name {
+				columns = append(columns, column)
+			}
+		}
+
+		onConflict.DoUpdates = append(clause.AssignmentColumns(columns), clause.Assignment{
+			Column: clause.Column{Name: versionField.DBName},
+			Value:  gorm.Expr("? + 1", clause.Column{Table: versionField.Schema.Table, Name: versionField.DBName}),
+		})
+	case len(o.updateColumns) > 0:
+		onConflict.DoUpdates = clause.AssignmentColumns(o.updateColumns)
+	default:
+		// gorm expands to all non-key columns and defaults conflict columns to primary keys
+		onConflict.UpdateAll = true
+	}
+
+	if len(onConflict.Columns) == 0 && !onConflict.UpdateAll {
+		// conflict target is required by PostgreSQL and SQLite
+		stmt := &gorm.Statement{DB: db.DB}
+		if err := stmt.Parse(value); err == nil {
+			for _, field := range stmt.Schema.PrimaryFields {
+				onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+			}
+		}
+	}
+
+	return onConflict
+}
+
+const (
+	upsertCountKey       = "dbo:upsert_count"
+	upsertInsertedColumn = "dbo_upsert_inserted"
+)
+
+// upsertCount rows returned by upsert of UpsertReturner dialect
+type upsertCount struct {
+	rows     int64
+	inserted int64
+}
+
+// registerUpsertReturning replace create callback of gorm for upsert of UpsertReturner dialect,
+// which returns UpsertInsertedExpr along with columns generated by database.
+// A RETURNING clause alone isn't enough, gorm scans returned columns into fields of model only and drops the others
+func registerUpsertReturning(db *gorm.DB, returner UpsertReturner) error {
+	create := db.Callback().Create().Get("gorm:create")
+	return db.Callback().Create().Replace("gorm:create", func(tx *gorm.DB) {
+		count, ok := tx.Get(upsertCountKey)
+		if !ok || tx.Error != nil || tx.Statement.Schema == nil || tx.Statement.SQL.Len() > 0 {
+			create(tx)
+			return
+		}
+
+		upsertReturning(tx, returner.UpsertInsertedExpr(), count.(*upsertCount))
+	})
+}
+
+// upsertReturning insert records of statement like create callback of gorm, count returned rows and inserted ones
+func upsertReturning(tx *gorm.DB, insertedExpr string, count *upsertCount) {
+	stmt := tx.Statement
+	if !stmt.Unscoped {
+		for _, c := range stmt.Schema.CreateClauses {
+			stmt.AddClause(c)
+		}
+	}
+
+	fields := stmt.Schema.FieldsWithDefaultDBValue
+	columns := make([]clause.Column, 0, len(fields)+1)
+	for _, field := range fields {
+		columns = append(columns, clause.Column{Name: field.DBName})
+	}
+	columns = append(columns, clause.Column{Name: insertedExpr + " AS " + upsertInsertedColumn, Raw: true})
+
+	stmt.AddClause(clause.Returning{Columns: columns})
+	stmt.AddClauseIfNotExists(clause.Insert{})
+	stmt.AddClause(callbacks.ConvertToCreateValues(stmt))
+	stmt.Build(stmt.BuildClauses...)
+	if tx.DryRun || tx.Error != nil {
+		return
+	}
+
+	rows, err := stmt.ConnPool.QueryContext(stmt.Context, stmt.SQL.String(), stmt.Vars...)
+	if tx.AddError(err) != nil {
+		return
+	}
+	defer func() {
+		tx.AddError(rows.Close())
+	}()
+
+	onConflict, _ := stmt.Clauses["ON CONFLICT"].Expression.(clause.OnConflict)
+	elems := upsertElems(stmt.ReflectValue)
+	values := make([]interface{}, len(columns))
+	tx.RowsAffected = 0
+	next := 0
+	for rows.Next() {
+		// rows are returned in the order of records, records kept on conflict are skipped
+		// and recognized by columns generated by database being set, the same as gorm does
+		for onConflict.DoNothing && next < len(elems) && len(fields) > 0 && !zeroFields(fields, elems[next]) {
+			next++
+		}
+		for i, field := range fields {
+			if next < len(elems) {
+				values[i] = field.ReflectValueOf(elems[next]).Addr().Interface()
+			} else {
+				values[i] = new(interface{})
+			}
+		}
+		next++
+
+		var inserted bool
+		values[len(values)-1] = &inserted
+		if tx.AddError(rows.Scan(values...)) != nil {
+			return
+		}
+
+		tx.RowsAffected++
+		count.rows++
+		if inserted {
+			count.inserted++
+		}
+	}
+	tx.AddError(rows.Err())
+}
+
+// upsertElems addressable structs of records in value
+func upsertElems(reflectValue reflect.Value) []reflect.Value {
+	reflectValue = reflect.Indirect(reflectValue)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems := make([]reflect.Value, 0, reflectValue.Len())
+		for i := 0; i < reflectValue.Len(); i++ {
+			elems = append(elems, reflect.Indirect(reflectValue.Index(i)))
+		}
+		return elems
+	case reflect.Struct:
+		return []reflect.Value{reflectValue}
+	default:
+		return nil
+	}
+}
+
+func zeroFields(fields []*schema.Field, elem reflect.Value) bool {
+	for _, field := range fields {
+		if _, zero := field.ValueOf(elem); !zero {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updatableColumns non-key columns updated on conflict, the same as gorm expands for UpdateAll
+func updatableColumns(modelSchema *schema.Schema) []string {
+	columns := make([]string, 0, len(modelSchema.DBNames))
+	for _, column := range modelSchema.DBNames {
+		field := modelSchema.FieldsByDBName[column]
+		if field.PrimaryKey || !field.Creatable || !field.Updatable || field.AutoCreateTime > 0 {
+			continue
+		}
+
+		if field.HasDefaultValue && field.DefaultValueInterface == nil {
+			continue
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+// countRows number of records in value, value is a struct or slice of structs
+func countRows(value interface{}) int64 {
+	reflectValue := reflect.Indirect(reflect.ValueOf(value))
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		return int64(reflectValue.Len())
+	default:
+		return 1
+	}
+}
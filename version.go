@@ -0,0 +1,165 @@
+package dbo
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// versionTag dbo tag value of version field, e.g. Version int64 with tag dbo:"version"
+const versionTag = "version"
+
+// Versioner optional model extension, name the version field of optimistic locking
+// instead of tagging it with `dbo:"version"`
+type Versioner interface {
+	// VersionField name or column of the integer version field
+	VersionField() string
+}
+
+// versionField integer version field of model for optimistic locking, nil if model is not versioned
+func (s *DBContext) versionField(value interface{}) *schema.Field {
+	stmt := &gorm.Statement{DB: s.DB}
+	if err := stmt.Parse(value); err != nil {
+		return nil
+	}
+
+	var field *schema.Field
+	if versioner, ok := reflect.New(stmt.Schema.ModelType).Interface().(Versioner); ok {
+		field = stmt.Schema.LookUpField(versioner.VersionField())
+	} else {
+		for _, f := range stmt.Schema.Fields {
+			if f.Tag.Get("dbo") == versionTag {
+				field = f
+				break
+			}
+		}
+	}
+
+	if field == nil || field.DBName == "" {
+		return nil
+	}
+
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field
+	default:
+		return nil
+	}
+}
+
+// initVersions set version of new records to 1, value is a struct or slice of structs
+func (s *DBContext) initVersions(value interface{}) {
+	field := s.versionField(value)
+	if field == nil {
+		return
+	}
+
+	reflectValue := reflect.Indirect(reflect.ValueOf(value))
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < reflectValue.Len(); i++ {
+			initVersion(field, reflect.Indirect(reflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		initVersion(field, reflectValue)
+	}
+}
+
+func initVersion(field *schema.Field, record reflect.Value) {
+	if !record.CanAddr() {
+		return
+	}
+
+	if _, zero := field.ValueOf(record); zero {
+		field.Set(record, int64(1))
+	}
+}
+
+// recordVersion version of a single existing record for optimistic locking
+type recordVersion struct {
+	field   *schema.Field
+	record  reflect.Value
+	current int64
+}
+
+// recordVersion version of value, nil if value is not a versioned existing record,
+// i.e. model is not versioned, value is not a single struct or its primary key is zero
+func (s *DBContext) recordVersion(value interface{}) *recordVersion {
+	field := s.versionField(value)
+	if field == nil {
+		return nil
+	}
+
+	record := reflect.Indirect(reflect.ValueOf(value))
+	if record.Kind() != reflect.Struct || !record.CanAddr() {
+		return nil
+	}
+
+	primaryFields := field.Schema.PrimaryFields
+	if len(primaryFields) == 0 {
+		return nil
+	}
+
+	for _, primaryField := range primaryFields {
+		if _, zero := primaryField.ValueOf(record); zero {
+			return nil
+		}
+	}
+
+	version := &recordVersion{field: field, record: record}
+	current := field.ReflectValueOf(record)
+	switch current.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		version.current = int64(current.Uint())
+	default:
+		version.current = current.Int()
+	}
+
+	return version
+}
+
+// update update all columns of record where version is unchanged, and increase the version
+func (s *recordVersion) update(db *DBContext, value interface{}) *gorm.DB {
+	s.field.Set(s.record, s.current+1)
+
+	return db.Model(value).
+		Select("*").
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: s.field.DBName}, Value: s.current}).
+		Updates(value)
+}
+
+// rollback restore version of record after failed update
+func (s *recordVersion) rollback() {
+	if s == nil {
+		return
+	}
+
+	s.field.Set(s.record, s.current)
+}
+
+// versionChanges changes with version increased, changes is copied and left untouched
+func (s *DBContext) versionChanges(value interface{}, changes map[string]interface{}) map[string]interface{} {
+	field := s.versionField(value)
+	if field == nil {
+		return changes
+	}
+
+	if _, ok := changes[field.DBName]; ok {
+		return changes
+	}
+
+	if _, ok := changes[field.Name]; ok {
+		return changes
+	}
+
+	versionChanges := make(map[string]interface{}, len(changes)+1)
+	for column, change := range changes {
+		versionChanges[column] = change
+	}
+	versionChanges[field.DBName] = gorm.Expr("? + 1", clause.Column{Name: field.DBName})
+
+	return versionChanges
+}